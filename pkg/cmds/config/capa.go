@@ -22,10 +22,16 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	_ "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilvalidation "k8s.io/apimachinery/pkg/util/validation"
 	"kmodules.xyz/client-go/tools/parser"
 	"sigs.k8s.io/yaml"
 )
@@ -33,12 +39,313 @@ import (
 const (
 	awsManagedControlPlaneKind = "AWSManagedControlPlane"
 	awsManagedMachinePoolKind  = "AWSManagedMachinePool"
+	awsClusterKind             = "AWSCluster"
+	awsMachineTemplateKind     = "AWSMachineTemplate"
 	machinePoolKind            = "MachinePool"
+	eksConfigKind              = "EKSConfig"
 	clusterKind                = "Cluster"
 	controlplaneRoleAnnotation = "eks.amazonaws.com/controlplane-role"
 	machinepoolRoleAnnotation  = "eks.amazonaws.com/machinepool-role"
+
+	awsMaxTagCount       = 50
+	awsMaxTagKeyLength   = 128
+	awsMaxTagValueLength = 256
+	awsMinRootVolumeSize = 8
+	awsReservedTagPrefix = "aws:"
+)
+
+var (
+	awsTagPattern        = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]*$`)
+	awsKMSKeyARNPattern  = regexp.MustCompile(`^arn:aws(-cn|-us-gov)?:kms:[a-z0-9-]+:\d{12}:(key/[a-zA-Z0-9-]+|alias/[a-zA-Z0-9/_-]+)$`)
+	awsIAMRoleARNPattern = regexp.MustCompile(`^arn:aws(-cn|-us-gov)?:iam::\d{12}:role/[\w+=,.@/-]+$`)
+	awsIAMUserARNPattern = regexp.MustCompile(`^arn:aws(-cn|-us-gov)?:iam::\d{12}:user/[\w+=,.@/-]+$`)
+	awsVPCIDPattern      = regexp.MustCompile(`^vpc-([0-9a-f]{8}|[0-9a-f]{17})$`)
+	awsSubnetIDPattern   = regexp.MustCompile(`^subnet-([0-9a-f]{8}|[0-9a-f]{17})$`)
+	awsAMIIDPattern      = regexp.MustCompile(`^ami-([0-9a-f]{8}|[0-9a-f]{17})$`)
+	awsSGIDPattern       = regexp.MustCompile(`^sg-([0-9a-f]{8}|[0-9a-f]{17})$`)
 )
 
+var awsVolumeTypes = []string{"standard", "gp2", "gp3", "io1", "io2", "st1", "sc1"}
+
+type awsLaunchTemplate struct {
+	amiID                    string
+	imageLookupFormat        string
+	httpTokens               string
+	httpPutResponseHopLimit  int64
+	rootVolumeSize           int64
+	rootVolumeType           string
+	rootVolumeEncrypted      bool
+	rootVolumeEncryptionKey  string
+	additionalSecurityGroups []string
+}
+
+// awsLaunchTemplateFromEnv reads the managed machine pool launch template settings, returning nil when none are set.
+func awsLaunchTemplateFromEnv() (*awsLaunchTemplate, error) {
+	lt := &awsLaunchTemplate{
+		amiID:                    os.Getenv("AWS_LAUNCH_TEMPLATE_AMI_ID"),
+		imageLookupFormat:        os.Getenv("AWS_LAUNCH_TEMPLATE_IMAGE_LOOKUP_FORMAT"),
+		httpTokens:               os.Getenv("AWS_LAUNCH_TEMPLATE_IMDS_HTTP_TOKENS"),
+		rootVolumeType:           os.Getenv("AWS_LAUNCH_TEMPLATE_ROOT_VOLUME_TYPE"),
+		rootVolumeEncryptionKey:  os.Getenv("AWS_LAUNCH_TEMPLATE_ROOT_VOLUME_KMS_KEY_ARN"),
+		additionalSecurityGroups: splitList(os.Getenv("AWS_LAUNCH_TEMPLATE_SECURITY_GROUP_IDS")),
+	}
+	var err error
+	if v := os.Getenv("AWS_LAUNCH_TEMPLATE_IMDS_HOP_LIMIT"); v != "" {
+		if lt.httpPutResponseHopLimit, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid AWS_LAUNCH_TEMPLATE_IMDS_HOP_LIMIT %q: %w", v, err)
+		}
+	}
+	if v := os.Getenv("AWS_LAUNCH_TEMPLATE_ROOT_VOLUME_SIZE"); v != "" {
+		if lt.rootVolumeSize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid AWS_LAUNCH_TEMPLATE_ROOT_VOLUME_SIZE %q: %w", v, err)
+		}
+	}
+	if v := os.Getenv("AWS_LAUNCH_TEMPLATE_ROOT_VOLUME_ENCRYPTED"); v != "" {
+		if lt.rootVolumeEncrypted, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid AWS_LAUNCH_TEMPLATE_ROOT_VOLUME_ENCRYPTED %q: %w", v, err)
+		}
+	}
+
+	if lt.amiID == "" && lt.imageLookupFormat == "" && lt.httpTokens == "" && lt.httpPutResponseHopLimit == 0 &&
+		lt.rootVolumeSize == 0 && lt.rootVolumeType == "" && !lt.rootVolumeEncrypted && lt.rootVolumeEncryptionKey == "" &&
+		len(lt.additionalSecurityGroups) == 0 {
+		return nil, nil
+	}
+	return lt, lt.validate()
+}
+
+func (lt *awsLaunchTemplate) validate() error {
+	if lt.amiID != "" && lt.imageLookupFormat != "" {
+		return errors.New("launch template AMI ID and image lookup format can't be used together")
+	}
+	if lt.amiID != "" && !awsAMIIDPattern.MatchString(lt.amiID) {
+		return fmt.Errorf("invalid AMI ID %q", lt.amiID)
+	}
+	if lt.httpTokens != "" && lt.httpTokens != "required" && lt.httpTokens != "optional" {
+		return fmt.Errorf("invalid instance metadata http tokens %q, must be required or optional", lt.httpTokens)
+	}
+	if lt.httpPutResponseHopLimit != 0 && (lt.httpPutResponseHopLimit < 1 || lt.httpPutResponseHopLimit > 64) {
+		return fmt.Errorf("instance metadata hop limit must be between 1 and 64, found %d", lt.httpPutResponseHopLimit)
+	}
+	if lt.rootVolumeType != "" {
+		if !slices.Contains(awsVolumeTypes, lt.rootVolumeType) {
+			return fmt.Errorf("invalid root volume type %q, must be one of %s", lt.rootVolumeType, strings.Join(awsVolumeTypes, ", "))
+		}
+		if lt.rootVolumeSize == 0 {
+			return errors.New("root volume size is required when root volume type is set")
+		}
+	}
+	if lt.rootVolumeSize != 0 && lt.rootVolumeSize < awsMinRootVolumeSize {
+		return fmt.Errorf("root volume size must be at least %d GiB, found %d", awsMinRootVolumeSize, lt.rootVolumeSize)
+	}
+	if lt.rootVolumeEncryptionKey != "" {
+		if !lt.rootVolumeEncrypted {
+			return errors.New("root volume encryption key requires root volume encryption to be enabled")
+		}
+		if !awsKMSKeyARNPattern.MatchString(lt.rootVolumeEncryptionKey) {
+			return fmt.Errorf("invalid KMS key ARN %q for root volume encryption", lt.rootVolumeEncryptionKey)
+		}
+	}
+	if (lt.rootVolumeEncrypted || lt.rootVolumeEncryptionKey != "") && lt.rootVolumeSize == 0 {
+		return errors.New("root volume size is required when root volume encryption is set")
+	}
+	for _, id := range lt.additionalSecurityGroups {
+		if !awsSGIDPattern.MatchString(id) {
+			return fmt.Errorf("invalid security group id %q", id)
+		}
+	}
+	return nil
+}
+
+// awsNodeUserData is the user data of managed machine pool nodes. Managed pools take their user data from
+// the MachinePool bootstrap, either as commands run around the EKSConfig bootstrap script or as a secret
+// with the complete user data, which replaces the EKSConfig.
+type awsNodeUserData struct {
+	preBootstrapCommands  []string
+	postBootstrapCommands []string
+	dataSecretName        string
+}
+
+// awsNodeUserDataFromEnv reads the bootstrap commands as yaml or json lists, e.g. `["echo pre-bootstrap"]`, returning nil when none are set.
+func awsNodeUserDataFromEnv() (*awsNodeUserData, error) {
+	ud := &awsNodeUserData{
+		dataSecretName: os.Getenv("AWS_NODE_USER_DATA_SECRET_NAME"),
+	}
+	for env, commands := range map[string]*[]string{
+		"AWS_NODE_PRE_BOOTSTRAP_COMMANDS":  &ud.preBootstrapCommands,
+		"AWS_NODE_POST_BOOTSTRAP_COMMANDS": &ud.postBootstrapCommands,
+	} {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+		if err := yaml.UnmarshalStrict([]byte(v), commands); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", env, err)
+		}
+	}
+
+	if ud.dataSecretName == "" && len(ud.preBootstrapCommands) == 0 && len(ud.postBootstrapCommands) == 0 {
+		return nil, nil
+	}
+	if ud.dataSecretName != "" {
+		if len(ud.preBootstrapCommands) > 0 || len(ud.postBootstrapCommands) > 0 {
+			return nil, errors.New("bootstrap commands can't be used together with a user data secret")
+		}
+		if errs := utilvalidation.IsDNS1123Subdomain(ud.dataSecretName); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid user data secret name %q: %s", ud.dataSecretName, strings.Join(errs, "; "))
+		}
+	}
+	return ud, nil
+}
+
+func setEKSConfigBootstrapCommands(ri *parser.ResourceInfo, ud *awsNodeUserData) error {
+	for field, commands := range map[string][]string{
+		"preBootstrapCommands":  ud.preBootstrapCommands,
+		"postBootstrapCommands": ud.postBootstrapCommands,
+	} {
+		if len(commands) == 0 {
+			continue
+		}
+		if err := unstructured.SetNestedStringSlice(ri.Object.UnstructuredContent(), commands, "spec", field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setMPUserDataSecret(ri *parser.ResourceInfo, secretName string) error {
+	unstructured.RemoveNestedField(ri.Object.UnstructuredContent(), "spec", "template", "spec", "bootstrap", "configRef")
+	return unstructured.SetNestedField(ri.Object.UnstructuredContent(), secretName, "spec", "template", "spec", "bootstrap", "dataSecretName")
+}
+
+type awsSubnet struct {
+	id       string
+	isPublic bool
+}
+
+// parseAWSSubnets parses a comma separated list of subnet IDs with their role, e.g. "subnet-0a1b2c3d:public,subnet-4e5f6a7b:private".
+func parseAWSSubnets(s string) ([]awsSubnet, error) {
+	var subnets []awsSubnet
+	for _, item := range splitList(s) {
+		id, role, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid subnet %q, expected format <subnet-id>:<public|private>", item)
+		}
+		if !awsSubnetIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid subnet id %q", id)
+		}
+		switch role {
+		case "public":
+			subnets = append(subnets, awsSubnet{id: id, isPublic: true})
+		case "private":
+			subnets = append(subnets, awsSubnet{id: id})
+		default:
+			return nil, fmt.Errorf("invalid role %q for subnet %s, must be public or private", role, id)
+		}
+	}
+	return subnets, nil
+}
+
+func parseAWSTags(s string) (map[string]string, error) {
+	tags, err := parseKeyValuePairs(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) > awsMaxTagCount {
+		return nil, fmt.Errorf("at most %d aws tags are allowed, found %d", awsMaxTagCount, len(tags))
+	}
+	for k, v := range tags {
+		if utf8.RuneCountInString(k) > awsMaxTagKeyLength {
+			return nil, fmt.Errorf("aws tag key %q is longer than %d characters", k, awsMaxTagKeyLength)
+		}
+		if utf8.RuneCountInString(v) > awsMaxTagValueLength {
+			return nil, fmt.Errorf("value of aws tag %q is longer than %d characters", k, awsMaxTagValueLength)
+		}
+		if strings.HasPrefix(strings.ToLower(k), awsReservedTagPrefix) {
+			return nil, fmt.Errorf("aws tag key %q uses the reserved %q prefix", k, awsReservedTagPrefix)
+		}
+		if !awsTagPattern.MatchString(k) || !awsTagPattern.MatchString(v) {
+			return nil, fmt.Errorf("aws tag %q=%q contains invalid characters", k, v)
+		}
+	}
+	return tags, nil
+}
+
+type eksAccessPrincipal struct {
+	ARN      string   `json:"arn"`
+	Username string   `json:"username"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+// parseEKSAccessPrincipals parses a yaml or json list of principals, e.g. `[{"arn": "arn:aws:iam::111122223333:role/admin", "username": "admin", "groups": ["system:masters"]}]`.
+// Role ARNs with a path are rejected rather than stripped, since aws-auth only matches role ARNs without the path.
+func parseEKSAccessPrincipals(s string) ([]eksAccessPrincipal, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var principals []eksAccessPrincipal
+	if err := yaml.UnmarshalStrict([]byte(s), &principals); err != nil {
+		return nil, fmt.Errorf("failed to parse EKS access principals: %w", err)
+	}
+	for _, p := range principals {
+		if !awsIAMRoleARNPattern.MatchString(p.ARN) && !awsIAMUserARNPattern.MatchString(p.ARN) {
+			return nil, fmt.Errorf("invalid IAM role or user ARN %q for EKS access", p.ARN)
+		}
+		if _, roleName, isRole := strings.Cut(p.ARN, ":role/"); isRole && strings.Contains(roleName, "/") {
+			return nil, fmt.Errorf("IAM role ARN %q for EKS access must not include a path, use the ARN without it", p.ARN)
+		}
+		if p.Username == "" {
+			return nil, fmt.Errorf("username is missing for EKS access principal %s", p.ARN)
+		}
+	}
+	return principals, nil
+}
+
+func setAWSManagedCPIAMAuthenticatorConfig(ri *parser.ResourceInfo, principals []eksAccessPrincipal) error {
+	mapRoles := make([]interface{}, 0)
+	mapUsers := make([]interface{}, 0)
+	for _, p := range principals {
+		groups := make([]interface{}, 0, len(p.Groups))
+		for _, g := range p.Groups {
+			groups = append(groups, g)
+		}
+		if awsIAMRoleARNPattern.MatchString(p.ARN) {
+			mapRoles = append(mapRoles, map[string]any{
+				"rolearn":  p.ARN,
+				"username": p.Username,
+				"groups":   groups,
+			})
+		} else {
+			mapUsers = append(mapUsers, map[string]any{
+				"userarn":  p.ARN,
+				"username": p.Username,
+				"groups":   groups,
+			})
+		}
+	}
+	authCfg := map[string]any{
+		"mapRoles": mapRoles,
+		"mapUsers": mapUsers,
+	}
+	return unstructured.SetNestedMap(ri.Object.UnstructuredContent(), authCfg, "spec", "iamAuthenticatorConfig")
+}
+
+func setAWSManagedCPEncryption(ri *parser.ResourceInfo, kmsKeyARN string) error {
+	encryptionCfg := map[string]any{
+		"provider":  kmsKeyARN,
+		"resources": []interface{}{"secrets"},
+	}
+	return unstructured.SetNestedMap(ri.Object.UnstructuredContent(), encryptionCfg, "spec", "encryptionConfig")
+}
+
+func setAWSAdditionalTags(ri *parser.ResourceInfo, tags map[string]string) error {
+	fields := []string{"spec", "additionalTags"}
+	if ri.Object.GetKind() == awsMachineTemplateKind {
+		fields = []string{"spec", "template", "spec", "additionalTags"}
+	}
+	return mergeNestedStringMap(ri.Object.UnstructuredContent(), tags, fields...)
+}
+
 func setAWSManagedCPCIDR(ri *parser.ResourceInfo, vpcCidr string) error {
 	netcfg := map[string]any{
 		"vpc": map[string]any{
@@ -51,6 +358,28 @@ func setAWSManagedCPCIDR(ri *parser.ResourceInfo, vpcCidr string) error {
 	return nil
 }
 
+func setAWSManagedCPExistingVPC(ri *parser.ResourceInfo, vpcID string, subnets []awsSubnet) error {
+	netcfg := map[string]any{
+		"vpc": map[string]any{
+			"id": vpcID,
+		},
+	}
+	if len(subnets) > 0 {
+		subnetCfg := make([]interface{}, 0, len(subnets))
+		for _, subnet := range subnets {
+			subnetCfg = append(subnetCfg, map[string]any{
+				"id":       subnet.id,
+				"isPublic": subnet.isPublic,
+			})
+		}
+		netcfg["subnets"] = subnetCfg
+	}
+	if err := unstructured.SetNestedMap(ri.Object.UnstructuredContent(), netcfg, "spec", "network"); err != nil {
+		return err
+	}
+	return nil
+}
+
 func setAWSManagedMPScaling(ri *parser.ResourceInfo, name string, minNodeCount, maxNodeCount int64) error {
 	scaling := map[string]any{
 		"minSize": minNodeCount,
@@ -65,6 +394,82 @@ func setAWSManagedMPScaling(ri *parser.ResourceInfo, name string, minNodeCount,
 	return nil
 }
 
+func setAWSManagedMPLaunchTemplate(ri *parser.ResourceInfo, lt *awsLaunchTemplate, instanceType string) error {
+	// EKS rejects node groups that set these alongside a launch template
+	for _, field := range []string{"remoteAccess", "diskSize"} {
+		if _, ok, _ := unstructured.NestedFieldNoCopy(ri.Object.UnstructuredContent(), "spec", field); ok {
+			return fmt.Errorf("spec.%s of AWSManagedMachinePool can't be used together with a launch template", field)
+		}
+	}
+
+	ltCfg, _, err := unstructured.NestedMap(ri.Object.UnstructuredContent(), "spec", "awsLaunchTemplate")
+	if err != nil {
+		return err
+	}
+	if ltCfg == nil {
+		ltCfg = make(map[string]any)
+	}
+	if instanceType == "" {
+		instanceType, _, err = unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "instanceType")
+		if err != nil {
+			return err
+		}
+	}
+	if instanceType != "" {
+		ltCfg["instanceType"] = instanceType
+		unstructured.RemoveNestedField(ri.Object.UnstructuredContent(), "spec", "instanceType")
+	}
+
+	if lt.amiID != "" {
+		ltCfg["ami"] = map[string]any{
+			"id": lt.amiID,
+		}
+		delete(ltCfg, "imageLookupFormat")
+	}
+	if lt.imageLookupFormat != "" {
+		ltCfg["imageLookupFormat"] = lt.imageLookupFormat
+		delete(ltCfg, "ami")
+	}
+	if lt.httpTokens != "" || lt.httpPutResponseHopLimit != 0 {
+		metadataOpts := map[string]any{
+			"httpEndpoint": "enabled",
+		}
+		if lt.httpTokens != "" {
+			metadataOpts["httpTokens"] = lt.httpTokens
+		}
+		if lt.httpPutResponseHopLimit != 0 {
+			metadataOpts["httpPutResponseHopLimit"] = lt.httpPutResponseHopLimit
+		}
+		ltCfg["instanceMetadataOptions"] = metadataOpts
+	}
+	if lt.rootVolumeSize != 0 {
+		rootVolume := map[string]any{
+			"size": lt.rootVolumeSize,
+		}
+		if lt.rootVolumeType != "" {
+			rootVolume["type"] = lt.rootVolumeType
+		}
+		if lt.rootVolumeEncrypted {
+			rootVolume["encrypted"] = true
+		}
+		if lt.rootVolumeEncryptionKey != "" {
+			rootVolume["encryptionKey"] = lt.rootVolumeEncryptionKey
+		}
+		ltCfg["rootVolume"] = rootVolume
+	}
+	if len(lt.additionalSecurityGroups) > 0 {
+		sgs := make([]interface{}, 0, len(lt.additionalSecurityGroups))
+		for _, id := range lt.additionalSecurityGroups {
+			sgs = append(sgs, map[string]any{
+				"id": id,
+			})
+		}
+		ltCfg["additionalSecurityGroups"] = sgs
+	}
+
+	return unstructured.SetNestedMap(ri.Object.UnstructuredContent(), ltCfg, "spec", "awsLaunchTemplate")
+}
+
 func setAWSClusterAnnotations(ri *parser.ResourceInfo, managedControlplaneRole, managedMachinepoolRole string) error {
 	if managedControlplaneRole != "" {
 		if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), managedControlplaneRole, "metadata", "annotations", controlplaneRoleAnnotation); err != nil {
@@ -84,21 +489,67 @@ type validationHelper struct {
 	managedControlplaneRole string
 	managedMachinepoolRole  string
 	vpcCidr                 string
+	vpcID                   string
+	subnets                 []awsSubnet
 	minCount, maxCount      int64
+	secretsKMSKeyARN        string
+	associateOIDCProvider   bool
+	ebsCSIDriverRoleARN     string
+	accessPrincipals        []eksAccessPrincipal
+	userData                *awsNodeUserData
 }
 
 func validation(helper validationHelper) error {
+	if helper.vpcCidr != "" && (helper.vpcID != "" || len(helper.subnets) > 0) {
+		return errors.New("VPC_CIDR can't be used together with VPC_ID or SUBNET_IDS")
+	}
+	if len(helper.subnets) > 0 && helper.vpcID == "" {
+		return errors.New("VPC_ID is required when SUBNET_IDS is set")
+	}
+	if helper.vpcID != "" && !awsVPCIDPattern.MatchString(helper.vpcID) {
+		return fmt.Errorf("invalid vpc id %q", helper.vpcID)
+	}
 	if !helper.isFound[awsManagedControlPlaneKind] {
 		if helper.vpcCidr != "" {
 			return errors.New("failed to get AWSManagedControlPlane for cidr update")
 		}
+		if helper.vpcID != "" {
+			return errors.New("failed to get AWSManagedControlPlane for vpc configuration")
+		}
 		if helper.managedControlplaneRole != "" {
 			return errors.New("failed to get AWSManagedControlPlane for role configuration")
 		}
+		if len(helper.accessPrincipals) > 0 {
+			return errors.New("failed to get AWSManagedControlPlane for access configuration")
+		}
+		if helper.secretsKMSKeyARN != "" || helper.associateOIDCProvider {
+			return errors.New("failed to get AWSManagedControlPlane for encryption and IRSA configuration")
+		}
+	}
+	if helper.secretsKMSKeyARN != "" && !awsKMSKeyARNPattern.MatchString(helper.secretsKMSKeyARN) {
+		return fmt.Errorf("invalid KMS key ARN %q for secrets encryption", helper.secretsKMSKeyARN)
+	}
+	if helper.ebsCSIDriverRoleARN != "" {
+		if !helper.associateOIDCProvider {
+			return errors.New("EBS CSI driver IRSA role requires the OIDC provider to be associated")
+		}
+		if !awsIAMRoleARNPattern.MatchString(helper.ebsCSIDriverRoleARN) {
+			return fmt.Errorf("invalid IAM role ARN %q for EBS CSI driver", helper.ebsCSIDriverRoleARN)
+		}
+	} else if helper.associateOIDCProvider {
+		return errors.New("EBS CSI driver IRSA role is required when the OIDC provider is associated")
 	}
 	if helper.minCount > helper.maxCount {
 		return errors.New("max node count can't be less than min node count")
 	}
+	if helper.userData != nil {
+		if helper.userData.dataSecretName != "" && !helper.isFound[machinePoolKind] {
+			return errors.New("failed to get MachinePool for user data configuration")
+		}
+		if helper.userData.dataSecretName == "" && !helper.isFound[eksConfigKind] {
+			return errors.New("failed to get EKSConfig for bootstrap commands")
+		}
+	}
 	if helper.managedMachinepoolRole != "" && !helper.isFound[awsManagedMachinePoolKind] {
 		return errors.New("failed to get AWSManagedMachinePool for role configuration")
 	}
@@ -123,14 +574,54 @@ func NewCmdCAPA() *cobra.Command {
 				return err
 			}
 			vpcCidr := os.Getenv("VPC_CIDR")
+			vpcID := os.Getenv("VPC_ID")
+			subnets, err := parseAWSSubnets(os.Getenv("SUBNET_IDS"))
+			if err != nil {
+				return err
+			}
 			clusterName := os.Getenv("CLUSTER_NAME")
 			managedControlplaneRole := os.Getenv("CONTROLPLANE_ROLE")
 			ebsCSIDriverVersion := os.Getenv("EBS_CSI_DRIVER_VERSION")
 			managedMachinepoolRole := fmt.Sprintf("nodes%s-%s-%s", clusterName, os.Getenv("CLUSTER_NAMESPACE"), os.Getenv("SUFFIX"))
 			nodeMachineType := os.Getenv("AWS_NODE_MACHINE_TYPE")
+			launchTemplate, err := awsLaunchTemplateFromEnv()
+			if err != nil {
+				return err
+			}
+			userData, err := awsNodeUserDataFromEnv()
+			if err != nil {
+				return err
+			}
+			// nodes of managed pools only run custom user data from a launch template
+			if userData != nil && launchTemplate == nil {
+				launchTemplate = &awsLaunchTemplate{}
+			}
+			additionalTags, err := parseAWSTags(os.Getenv("AWS_ADDITIONAL_TAGS"))
+			if err != nil {
+				return err
+			}
+			accessPrincipals, err := parseEKSAccessPrincipals(os.Getenv("EKS_ACCESS_PRINCIPALS"))
+			if err != nil {
+				return err
+			}
+			secretsKMSKeyARN := os.Getenv("EKS_SECRETS_KMS_KEY_ARN")
+			ebsCSIDriverRoleARN := os.Getenv("EBS_CSI_DRIVER_ROLE_ARN")
+			var associateOIDCProvider bool
+			if v := os.Getenv("EKS_ASSOCIATE_OIDC_PROVIDER"); v != "" {
+				if associateOIDCProvider, err = strconv.ParseBool(v); err != nil {
+					return fmt.Errorf("invalid EKS_ASSOCIATE_OIDC_PROVIDER %q: %w", v, err)
+				}
+			}
 
 			var out bytes.Buffer
 			err = parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
+				switch ri.Object.GetKind() {
+				case awsManagedControlPlaneKind, awsManagedMachinePoolKind, awsClusterKind, awsMachineTemplateKind:
+					if err := setAWSAdditionalTags(&ri, additionalTags); err != nil {
+						return err
+					}
+				}
+
 				if ri.Object.GetKind() == awsManagedControlPlaneKind {
 					isFound[awsManagedControlPlaneKind] = true
 					if vpcCidr != "" {
@@ -138,6 +629,10 @@ func NewCmdCAPA() *cobra.Command {
 						if err != nil {
 							return err
 						}
+					} else if vpcID != "" {
+						if err := setAWSManagedCPExistingVPC(&ri, vpcID, subnets); err != nil {
+							return err
+						}
 					}
 					if managedControlplaneRole != "" {
 						if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), managedControlplaneRole, "spec", "roleName"); err != nil {
@@ -149,13 +644,30 @@ func NewCmdCAPA() *cobra.Command {
 							return err
 						}
 					}
-					addons := []interface{}{
-						map[string]any{
-							"name":               "aws-ebs-csi-driver",
-							"version":            ebsCSIDriverVersion,
-							"conflictResolution": "overwrite",
-						},
+					if secretsKMSKeyARN != "" {
+						if err := setAWSManagedCPEncryption(&ri, secretsKMSKeyARN); err != nil {
+							return err
+						}
+					}
+					if len(accessPrincipals) > 0 {
+						if err := setAWSManagedCPIAMAuthenticatorConfig(&ri, accessPrincipals); err != nil {
+							return err
+						}
+					}
+					if associateOIDCProvider {
+						if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), true, "spec", "associateOIDCProvider"); err != nil {
+							return err
+						}
+					}
+					ebsCSIDriver := map[string]any{
+						"name":               "aws-ebs-csi-driver",
+						"version":            ebsCSIDriverVersion,
+						"conflictResolution": "overwrite",
+					}
+					if ebsCSIDriverRoleARN != "" {
+						ebsCSIDriver["serviceAccountRoleARN"] = ebsCSIDriverRoleARN
 					}
+					addons := []interface{}{ebsCSIDriver}
 					if err := unstructured.SetNestedSlice(ri.Object.UnstructuredContent(), addons, "spec", "addons"); err != nil {
 						return err
 					}
@@ -167,6 +679,20 @@ func NewCmdCAPA() *cobra.Command {
 					if err != nil {
 						return err
 					}
+					if userData != nil && userData.dataSecretName != "" {
+						if err := setMPUserDataSecret(&ri, userData.dataSecretName); err != nil {
+							return err
+						}
+					}
+				}
+
+				if ri.Object.GetKind() == eksConfigKind {
+					isFound[eksConfigKind] = true
+					if userData != nil && userData.dataSecretName == "" {
+						if err := setEKSConfigBootstrapCommands(&ri, userData); err != nil {
+							return err
+						}
+					}
 				}
 
 				if ri.Object.GetKind() == awsManagedMachinePoolKind {
@@ -180,7 +706,11 @@ func NewCmdCAPA() *cobra.Command {
 							return err
 						}
 					}
-					if nodeMachineType != "" {
+					if launchTemplate != nil {
+						if err := setAWSManagedMPLaunchTemplate(&ri, launchTemplate, nodeMachineType); err != nil {
+							return err
+						}
+					} else if nodeMachineType != "" {
 						if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), nodeMachineType, "spec", "instanceType"); err != nil {
 							return err
 						}
@@ -215,8 +745,15 @@ func NewCmdCAPA() *cobra.Command {
 				managedControlplaneRole: managedControlplaneRole,
 				managedMachinepoolRole:  managedMachinepoolRole,
 				vpcCidr:                 vpcCidr,
+				vpcID:                   vpcID,
+				subnets:                 subnets,
 				minCount:                minNodeCount,
 				maxCount:                maxNodeCount,
+				secretsKMSKeyARN:        secretsKMSKeyARN,
+				associateOIDCProvider:   associateOIDCProvider,
+				ebsCSIDriverRoleARN:     ebsCSIDriverRoleARN,
+				accessPrincipals:        accessPrincipals,
+				userData:                userData,
 			})
 			if err != nil {
 				return err
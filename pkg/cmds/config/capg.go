@@ -19,19 +19,468 @@ package config
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	_ "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilvalidation "k8s.io/apimachinery/pkg/util/validation"
 	"kmodules.xyz/client-go/tools/parser"
 	"sigs.k8s.io/yaml"
 )
 
+// gcpSecondaryRanges are the pod and service CIDRs of a VPC-native cluster. GKE creates the secondary
+// ranges on the subnet from these CIDRs; GCPManagedControlPlane can't reference existing ranges by name,
+// so the subnet is not given secondaryCidrBlocks, which would overlap the ranges created by GKE.
+type gcpSecondaryRanges struct {
+	podCidr     string
+	serviceCidr string
+}
+
+func gcpSecondaryRangesFromEnv(subnetCidr string) (*gcpSecondaryRanges, error) {
+	sr := &gcpSecondaryRanges{
+		podCidr:     os.Getenv("GCP_POD_CIDR"),
+		serviceCidr: os.Getenv("GCP_SERVICE_CIDR"),
+	}
+	if !sr.isSet() {
+		return sr, nil
+	}
+	if sr.podCidr == "" || sr.serviceCidr == "" {
+		return nil, errors.New("both GCP_POD_CIDR and GCP_SERVICE_CIDR are required for VPC-native clusters")
+	}
+	err := validateNonOverlappingCIDRs(map[string]string{
+		"subnet CIDR":  subnetCidr,
+		"pod CIDR":     sr.podCidr,
+		"service CIDR": sr.serviceCidr,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sr, nil
+}
+
+func (sr *gcpSecondaryRanges) isSet() bool {
+	return sr.podCidr != "" || sr.serviceCidr != ""
+}
+
+func SetGCPManagedCPIPAllocationPolicy(ri parser.ResourceInfo, sr *gcpSecondaryRanges) error {
+	clusterNetwork, _, err := unstructured.NestedMap(ri.Object.UnstructuredContent(), "spec", "clusterNetwork")
+	if err != nil {
+		return err
+	}
+	if clusterNetwork == nil {
+		clusterNetwork = make(map[string]any)
+	}
+	clusterNetwork["useIPAliases"] = true
+	clusterNetwork["pod"] = map[string]any{
+		"cidrBlock": sr.podCidr,
+	}
+	clusterNetwork["service"] = map[string]any{
+		"cidrBlock": sr.serviceCidr,
+	}
+	return unstructured.SetNestedMap(ri.Object.UnstructuredContent(), clusterNetwork, "spec", "clusterNetwork")
+}
+
+type gcpAuthorizedNetwork struct {
+	displayName string
+	cidr        string
+}
+
+type gcpPrivateCluster struct {
+	privateNodes       bool
+	privateEndpoint    bool
+	masterCidr         string
+	authorizedNetworks []gcpAuthorizedNetwork
+}
+
+func gcpPrivateClusterFromEnv(subnetCidr string, secondaryRanges *gcpSecondaryRanges) (*gcpPrivateCluster, error) {
+	pc := &gcpPrivateCluster{
+		masterCidr: os.Getenv("GKE_MASTER_IPV4_CIDR"),
+	}
+	var err error
+	if v := os.Getenv("GKE_PRIVATE_NODES"); v != "" {
+		if pc.privateNodes, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid GKE_PRIVATE_NODES %q: %w", v, err)
+		}
+	}
+	if v := os.Getenv("GKE_PRIVATE_ENDPOINT"); v != "" {
+		if pc.privateEndpoint, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid GKE_PRIVATE_ENDPOINT %q: %w", v, err)
+		}
+	}
+	// authorized networks are given as cidr or display-name=cidr
+	for _, item := range splitList(os.Getenv("GKE_MASTER_AUTHORIZED_NETWORKS")) {
+		an := gcpAuthorizedNetwork{cidr: item}
+		if name, cidr, ok := strings.Cut(item, "="); ok {
+			an = gcpAuthorizedNetwork{displayName: name, cidr: cidr}
+		}
+		if _, _, err := net.ParseCIDR(an.cidr); err != nil {
+			return nil, fmt.Errorf("invalid master authorized network %q: %w", an.cidr, err)
+		}
+		pc.authorizedNetworks = append(pc.authorizedNetworks, an)
+	}
+
+	if pc.privateEndpoint && !pc.privateNodes {
+		return nil, errors.New("private endpoint requires private nodes")
+	}
+	if pc.privateNodes {
+		if pc.masterCidr == "" {
+			return nil, errors.New("GKE_MASTER_IPV4_CIDR is required for private nodes")
+		}
+		ip, ipNet, err := net.ParseCIDR(pc.masterCidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid master IPv4 CIDR %q: %w", pc.masterCidr, err)
+		}
+		if ones, bits := ipNet.Mask.Size(); ones != 28 || bits != 32 {
+			return nil, fmt.Errorf("master IPv4 CIDR %s must be an IPv4 /28 range", pc.masterCidr)
+		}
+		if !ip.Equal(ipNet.IP) {
+			return nil, fmt.Errorf("master IPv4 CIDR %s is not aligned to a /28 boundary, use %s", pc.masterCidr, ipNet.String())
+		}
+		if !ip.IsPrivate() {
+			return nil, fmt.Errorf("master IPv4 CIDR %s must be a private range", pc.masterCidr)
+		}
+		err = validateNonOverlappingCIDRs(map[string]string{
+			"master IPv4 CIDR": pc.masterCidr,
+			"subnet CIDR":      subnetCidr,
+			"pod CIDR":         secondaryRanges.podCidr,
+			"service CIDR":     secondaryRanges.serviceCidr,
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else if pc.masterCidr != "" {
+		return nil, errors.New("GKE_MASTER_IPV4_CIDR can only be set for private nodes")
+	}
+	return pc, nil
+}
+
+func (pc *gcpPrivateCluster) isSet() bool {
+	return pc.privateNodes || len(pc.authorizedNetworks) > 0
+}
+
+func SetGCPManagedCPPrivateCluster(ri parser.ResourceInfo, pc *gcpPrivateCluster) error {
+	obj := ri.Object.UnstructuredContent()
+	if pc.privateNodes {
+		privateCluster := map[string]any{
+			"enablePrivateEndpoint": pc.privateEndpoint,
+			"controlPlaneCidrBlock": pc.masterCidr,
+		}
+		if err := unstructured.SetNestedMap(obj, privateCluster, "spec", "clusterNetwork", "privateCluster"); err != nil {
+			return err
+		}
+	}
+	if len(pc.authorizedNetworks) > 0 {
+		cidrBlocks := make([]interface{}, 0, len(pc.authorizedNetworks))
+		for _, an := range pc.authorizedNetworks {
+			// CAPG uses snake case field names for master authorized networks
+			block := map[string]any{
+				"cidr_block": an.cidr,
+			}
+			if an.displayName != "" {
+				block["display_name"] = an.displayName
+			}
+			cidrBlocks = append(cidrBlocks, block)
+		}
+		if err := unstructured.SetNestedSlice(obj, cidrBlocks, "spec", "master_authorized_networks_config", "cidr_blocks"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	gcpDiskTypes             = []string{"pd-standard", "pd-ssd", "pd-balanced"}
+	gcpImageTypes            = []string{"COS_CONTAINERD", "UBUNTU_CONTAINERD", "WINDOWS_LTSC_CONTAINERD", "WINDOWS_SAC_CONTAINERD"}
+	gcpServiceAccountPattern = regexp.MustCompile(`^([a-z][a-z0-9-]{4,28}[a-z0-9]@[a-z][a-z0-9-]{4,28}[a-z0-9]\.iam\.gserviceaccount\.com|[0-9]+-compute@developer\.gserviceaccount\.com|[a-z][a-z0-9-]{4,28}[a-z0-9]@appspot\.gserviceaccount\.com|default)$`)
+)
+
+type gcpMachinePoolOptions struct {
+	diskSizeGB     int64
+	diskType       string
+	imageType      string
+	labels         map[string]string
+	taints         []nodeTaint
+	networkTags    []string
+	serviceAccount string
+}
+
+func gcpMachinePoolOptionsFromEnv() (*gcpMachinePoolOptions, error) {
+	opts := &gcpMachinePoolOptions{
+		diskType:       os.Getenv("GKE_NODE_DISK_TYPE"),
+		imageType:      os.Getenv("GKE_NODE_IMAGE_TYPE"),
+		networkTags:    splitList(os.Getenv("GKE_NODE_NETWORK_TAGS")),
+		serviceAccount: os.Getenv("GKE_NODE_SERVICE_ACCOUNT"),
+	}
+	var err error
+	if v := os.Getenv("GKE_NODE_DISK_SIZE_GB"); v != "" {
+		if opts.diskSizeGB, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid GKE_NODE_DISK_SIZE_GB %q: %w", v, err)
+		}
+		if opts.diskSizeGB < 10 {
+			return nil, fmt.Errorf("node disk size must be at least 10 GB, found %d", opts.diskSizeGB)
+		}
+	}
+	if opts.labels, err = parseNodeLabels(os.Getenv("GKE_NODE_LABELS")); err != nil {
+		return nil, err
+	}
+	if opts.taints, err = parseTaints(os.Getenv("GKE_NODE_TAINTS")); err != nil {
+		return nil, err
+	}
+	if err := validateOneOf("node disk type", opts.diskType, gcpDiskTypes); err != nil {
+		return nil, err
+	}
+	if err := validateOneOf("node image type", opts.imageType, gcpImageTypes); err != nil {
+		return nil, err
+	}
+	for _, tag := range opts.networkTags {
+		if errs := utilvalidation.IsDNS1035Label(tag); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid network tag %q: %s", tag, strings.Join(errs, "; "))
+		}
+	}
+	if opts.serviceAccount != "" && !gcpServiceAccountPattern.MatchString(opts.serviceAccount) {
+		return nil, fmt.Errorf("invalid node service account %q", opts.serviceAccount)
+	}
+	return opts, nil
+}
+
+func SetGCPManagedMPOptions(ri parser.ResourceInfo, opts *gcpMachinePoolOptions) error {
+	obj := ri.Object.UnstructuredContent()
+	if opts.diskSizeGB != 0 {
+		if err := unstructured.SetNestedField(obj, opts.diskSizeGB, "spec", "diskSizeGb"); err != nil {
+			return err
+		}
+	}
+	if opts.diskType != "" {
+		if err := unstructured.SetNestedField(obj, opts.diskType, "spec", "diskType"); err != nil {
+			return err
+		}
+	}
+	if opts.imageType != "" {
+		if err := unstructured.SetNestedField(obj, opts.imageType, "spec", "imageType"); err != nil {
+			return err
+		}
+	}
+	if err := mergeNestedStringMap(obj, opts.labels, "spec", "kubernetesLabels"); err != nil {
+		return err
+	}
+	if err := mergeNestedTaints(obj, opts.taints, "spec", "kubernetesTaints"); err != nil {
+		return err
+	}
+	if len(opts.networkTags) > 0 {
+		if err := unstructured.SetNestedStringSlice(obj, opts.networkTags, "spec", "nodeNetwork", "tags"); err != nil {
+			return err
+		}
+	}
+	if opts.serviceAccount != "" {
+		if err := unstructured.SetNestedField(obj, opts.serviceAccount, "spec", "nodeSecurity", "serviceAccount", "email"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	gcpClusterKind          = "GCPCluster"
+	gcpMachineTemplateKind  = "GCPMachineTemplate"
+	kubeadmControlPlaneKind = "KubeadmControlPlane"
+)
+
+// gcpControlPlaneMachineTemplate reports whether the input describes a self-managed GCPCluster and
+// returns the name of the GCPMachineTemplate referenced by its KubeadmControlPlane.
+func gcpControlPlaneMachineTemplate(in []byte) (bool, string, error) {
+	var selfManaged bool
+	var cpTemplate string
+	err := parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
+		if ri.Object.GetAPIVersion() == infraApiVersion &&
+			ri.Object.GetKind() == gcpClusterKind {
+			selfManaged = true
+		} else if ri.Object.GetAPIVersion() == controlPlaneApiVersion &&
+			ri.Object.GetKind() == kubeadmControlPlaneKind {
+			name, _, err := unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "machineTemplate", "infrastructureRef", "name")
+			if err != nil {
+				return err
+			}
+			cpTemplate = name
+		}
+		return nil
+	})
+	return selfManaged, cpTemplate, err
+}
+
+type gcpImage struct {
+	image       string
+	imageFamily string
+}
+
+func SetGCPMachineTemplate(ri parser.ResourceInfo, instanceType string, img gcpImage) error {
+	obj := ri.Object.UnstructuredContent()
+	if instanceType != "" {
+		if err := unstructured.SetNestedField(obj, instanceType, "spec", "template", "spec", "instanceType"); err != nil {
+			return err
+		}
+	}
+	if img.image != "" {
+		unstructured.RemoveNestedField(obj, "spec", "template", "spec", "imageFamily")
+		if err := unstructured.SetNestedField(obj, img.image, "spec", "template", "spec", "image"); err != nil {
+			return err
+		}
+	}
+	if img.imageFamily != "" {
+		unstructured.RemoveNestedField(obj, "spec", "template", "spec", "image")
+		if err := unstructured.SetNestedField(obj, img.imageFamily, "spec", "template", "spec", "imageFamily"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const gcpMaxLabelCount = 64
+
+var (
+	gcpLabelKeyPattern     = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+	gcpLabelValuePattern   = regexp.MustCompile(`^[a-z0-9_-]{0,63}$`)
+	gcpWorkloadPoolPattern = regexp.MustCompile(`^[a-z][a-z0-9.:-]*\.svc\.id\.goog$`)
+)
+
+func parseGCPLabels(s string) (map[string]string, error) {
+	labels, err := parseKeyValuePairs(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(labels) > gcpMaxLabelCount {
+		return nil, fmt.Errorf("at most %d gcp labels are allowed, found %d", gcpMaxLabelCount, len(labels))
+	}
+	for k, v := range labels {
+		if !gcpLabelKeyPattern.MatchString(k) {
+			return nil, fmt.Errorf("invalid gcp label key %q, must start with a lowercase letter and contain at most 63 lowercase letters, digits, _ or -", k)
+		}
+		if !gcpLabelValuePattern.MatchString(v) {
+			return nil, fmt.Errorf("invalid value %q of gcp label %s, must contain at most 63 lowercase letters, digits, _ or -", v, k)
+		}
+	}
+	return labels, nil
+}
+
+// setGCPLabels merges the labels into the field each kind uses for labels of the GCP resources it creates.
+func setGCPLabels(ri parser.ResourceInfo, labels map[string]string) error {
+	var fields []string
+	switch ri.Object.GetKind() {
+	case "GCPManagedCluster":
+		fields = []string{"spec", "resourceLabels"}
+	case "GCPManagedMachinePool", gcpClusterKind:
+		fields = []string{"spec", "additionalLabels"}
+	case gcpMachineTemplateKind:
+		fields = []string{"spec", "template", "spec", "additionalLabels"}
+	default:
+		return nil
+	}
+	return mergeNestedStringMap(ri.Object.UnstructuredContent(), labels, fields...)
+}
+
+// SetGCPWorkloadIdentity enables workload identity, defaulting the pool to <project>.svc.id.goog.
+func SetGCPWorkloadIdentity(ri parser.ResourceInfo, workloadPool string) error {
+	project, _, err := unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "project")
+	if err != nil {
+		return err
+	}
+	if workloadPool == "" {
+		if project == "" {
+			return errors.New("project in spec of GCPManagedControlPlane is missing to derive the workload identity pool")
+		}
+		workloadPool = project + ".svc.id.goog"
+	}
+	if !gcpWorkloadPoolPattern.MatchString(workloadPool) {
+		return fmt.Errorf("invalid workload identity pool %q, expected <project>.svc.id.goog", workloadPool)
+	}
+	if project != "" && workloadPool != project+".svc.id.goog" {
+		return fmt.Errorf("workload identity pool %s does not belong to project %s", workloadPool, project)
+	}
+	return unstructured.SetNestedField(ri.Object.UnstructuredContent(), workloadPool, "spec", "workloadIdentityConfig", "workloadPool")
+}
+
+var gcpProjectIDPattern = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+
+type gcpSharedVPC struct {
+	hostProject string
+	network     string
+	subnet      string
+}
+
+func gcpSharedVPCFromEnv() (*gcpSharedVPC, error) {
+	vpc := &gcpSharedVPC{
+		hostProject: os.Getenv("GCP_SHARED_VPC_HOST_PROJECT"),
+		network:     os.Getenv("GCP_SHARED_VPC_NETWORK"),
+		subnet:      os.Getenv("GCP_SHARED_VPC_SUBNET"),
+	}
+	if !vpc.isSet() {
+		if vpc.network != "" || vpc.subnet != "" {
+			return nil, errors.New("GCP_SHARED_VPC_HOST_PROJECT is required for shared VPC networks")
+		}
+		return vpc, nil
+	}
+	if !gcpProjectIDPattern.MatchString(vpc.hostProject) {
+		return nil, fmt.Errorf("invalid shared VPC host project %q", vpc.hostProject)
+	}
+	if vpc.network == "" {
+		return nil, errors.New("GCP_SHARED_VPC_NETWORK is required for shared VPC networks")
+	}
+	for _, name := range []string{vpc.network, vpc.subnet} {
+		if name == "" {
+			continue
+		}
+		if errs := utilvalidation.IsDNS1035Label(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid shared VPC network or subnet name %q: %s", name, strings.Join(errs, "; "))
+		}
+	}
+	return vpc, nil
+}
+
+func (vpc *gcpSharedVPC) isSet() bool {
+	return vpc.hostProject != ""
+}
+
+// SetGCPSharedVPCConfiguration references a network owned by the host project. The network and its subnets
+// are managed in the host project, so autoCreateSubnetworks is left as is and no subnet is created.
+func SetGCPSharedVPCConfiguration(ri parser.ResourceInfo, vpc *gcpSharedVPC) error {
+	obj := ri.Object.UnstructuredContent()
+	if err := unstructured.SetNestedField(obj, vpc.hostProject, "spec", "network", "hostProject"); err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedField(obj, vpc.network, "spec", "network", "name"); err != nil {
+		return err
+	}
+	if vpc.subnet != "" {
+		region, ok, err := unstructured.NestedString(obj, "spec", "region")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("region name is missing")
+		}
+		subnets := []interface{}{
+			map[string]any{
+				"name":   vpc.subnet,
+				"region": region,
+			},
+		}
+		if err := unstructured.SetNestedSlice(obj, subnets, "spec", "network", "subnets"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func NewCmdCAPG() *cobra.Command {
 	var minSize int64
 	var maxSize int64
+	var controlPlaneReplicas int64
 
 	cmd := &cobra.Command{
 		Use:               "capg",
@@ -43,25 +492,101 @@ func NewCmdCAPG() *cobra.Command {
 				return err
 			}
 			subnetCidr := os.Getenv("SUBNET_CIDR")
-			if subnetCidr == "" {
-				_, err = os.Stdout.Write(in)
-				return err
-			}
 			clusterName := os.Getenv("CLUSTER_NAME")
 			kubernetesVersion := os.Getenv("KUBERNETES_VERSION")
+			releaseChannel := os.Getenv("GKE_RELEASE_CHANNEL")
+			if err := validateOneOf("release channel", releaseChannel, gkeReleaseChannels); err != nil {
+				return err
+			}
+			// only an explicit channel is checked against the version table, the implicit stable
+			// default is kept as is so that a lagging table doesn't break existing pipelines
+			validateReleaseChannel := releaseChannel != ""
+			if releaseChannel == "" && kubernetesVersion != "" {
+				releaseChannel = "stable"
+			}
 			nodeMachineType := os.Getenv("GCP_NODE_MACHINE_TYPE")
+			secondaryRanges, err := gcpSecondaryRangesFromEnv(subnetCidr)
+			if err != nil {
+				return err
+			}
+			privateCluster, err := gcpPrivateClusterFromEnv(subnetCidr, secondaryRanges)
+			if err != nil {
+				return err
+			}
+			machinePoolOptions, err := gcpMachinePoolOptionsFromEnv()
+			if err != nil {
+				return err
+			}
+			selfManaged, cpTemplate, err := gcpControlPlaneMachineTemplate(in)
+			if err != nil {
+				return err
+			}
+			cpMachineType := os.Getenv("GCP_CONTROL_PLANE_MACHINE_TYPE")
+			image := gcpImage{
+				image:       os.Getenv("GCP_IMAGE"),
+				imageFamily: os.Getenv("GCP_IMAGE_FAMILY"),
+			}
+			if image.image != "" && image.imageFamily != "" {
+				return errors.New("GCP_IMAGE and GCP_IMAGE_FAMILY can't be used together")
+			}
+			if controlPlaneReplicas < 0 || (controlPlaneReplicas > 0 && controlPlaneReplicas%2 == 0) {
+				return fmt.Errorf("control plane replicas must be an odd number, found %d", controlPlaneReplicas)
+			}
+			sharedVPC, err := gcpSharedVPCFromEnv()
+			if err != nil {
+				return err
+			}
+			if sharedVPC.isSet() && subnetCidr != "" {
+				return errors.New("SUBNET_CIDR can't be used with a shared VPC, subnets are managed in the host project")
+			}
+			if sharedVPC.isSet() && secondaryRanges.isSet() {
+				return errors.New("GCP_POD_CIDR and GCP_SERVICE_CIDR can't be used with a shared VPC, GKE can't create secondary ranges in the host project's subnet")
+			}
+			labels, err := parseGCPLabels(os.Getenv("GCP_LABELS"))
+			if err != nil {
+				return err
+			}
+			workloadPool := os.Getenv("GKE_WORKLOAD_POOL")
+			var workloadIdentity bool
+			if v := os.Getenv("GKE_WORKLOAD_IDENTITY"); v != "" {
+				if workloadIdentity, err = strconv.ParseBool(v); err != nil {
+					return fmt.Errorf("invalid GKE_WORKLOAD_IDENTITY %q: %w", v, err)
+				}
+			}
+			if workloadPool != "" && !workloadIdentity {
+				return errors.New("GKE_WORKLOAD_POOL requires GKE_WORKLOAD_IDENTITY to be enabled")
+			}
+			if selfManaged && secondaryRanges.isSet() {
+				return errors.New("secondary ranges are only supported for GKE clusters")
+			}
 
 			var out bytes.Buffer
 			var foundCP bool
 			var foundMP bool
 			var foundManagedMP bool
+			var foundManagedCP bool
+			var foundCPTemplate bool
+			var foundWorkerTemplate bool
 			err = parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
+				if ri.Object.GetAPIVersion() == infraApiVersion {
+					if err := setGCPLabels(ri, labels); err != nil {
+						return err
+					}
+				}
+
 				if ri.Object.GetAPIVersion() == infraApiVersion &&
-					ri.Object.GetKind() == "GCPManagedCluster" {
+					(ri.Object.GetKind() == "GCPManagedCluster" || ri.Object.GetKind() == gcpClusterKind) {
 					foundCP = true
 
-					if err = SetGCPNetworkConfiguration(ri, subnetCidr); err != nil {
-						return err
+					// without a subnet cidr the network is left as is, e.g. in auto subnet mode
+					if sharedVPC.isSet() {
+						if err = SetGCPSharedVPCConfiguration(ri, sharedVPC); err != nil {
+							return err
+						}
+					} else if subnetCidr != "" {
+						if err = SetGCPNetworkConfiguration(ri, subnetCidr); err != nil {
+							return err
+						}
 					}
 
 				} else if ri.Object.GetAPIVersion() == infraApiVersion &&
@@ -76,6 +601,9 @@ func NewCmdCAPG() *cobra.Command {
 							return err
 						}
 					}
+					if err = SetGCPManagedMPOptions(ri, machinePoolOptions); err != nil {
+						return err
+					}
 
 				} else if ri.Object.GetAPIVersion() == clusterApiVersion &&
 					ri.Object.GetKind() == "MachinePool" {
@@ -84,8 +612,47 @@ func NewCmdCAPG() *cobra.Command {
 					if err = SetMPConfiguration(ri, deafultMachinePoolName, minSize, maxSize); err != nil {
 						return err
 					}
-				} else if ri.Object.GetAPIVersion() == "infrastructure.cluster.x-k8s.io/v1beta1" &&
+				} else if ri.Object.GetAPIVersion() == infraApiVersion &&
+					ri.Object.GetKind() == gcpMachineTemplateKind {
+
+					instanceType := nodeMachineType
+					if ri.Object.GetName() == cpTemplate {
+						foundCPTemplate = true
+						instanceType = cpMachineType
+					} else {
+						foundWorkerTemplate = true
+					}
+					if err = SetGCPMachineTemplate(ri, instanceType, image); err != nil {
+						return err
+					}
+
+				} else if ri.Object.GetAPIVersion() == controlPlaneApiVersion &&
+					ri.Object.GetKind() == kubeadmControlPlaneKind {
+
+					if controlPlaneReplicas > 0 {
+						if err = unstructured.SetNestedField(ri.Object.UnstructuredContent(), controlPlaneReplicas, "spec", "replicas"); err != nil {
+							return err
+						}
+					}
+
+				} else if ri.Object.GetAPIVersion() == infraApiVersion &&
 					ri.Object.GetKind() == "GCPManagedControlPlane" {
+					foundManagedCP = true
+					if workloadIdentity {
+						if err = SetGCPWorkloadIdentity(ri, workloadPool); err != nil {
+							return err
+						}
+					}
+					if secondaryRanges.isSet() {
+						if err = SetGCPManagedCPIPAllocationPolicy(ri, secondaryRanges); err != nil {
+							return err
+						}
+					}
+					if privateCluster.isSet() {
+						if err = SetGCPManagedCPPrivateCluster(ri, privateCluster); err != nil {
+							return err
+						}
+					}
 					if clusterName != "" {
 						if err = unstructured.SetNestedField(ri.Object.UnstructuredContent(), clusterName, "spec", "clusterName"); err != nil {
 							return err
@@ -95,7 +662,9 @@ func NewCmdCAPG() *cobra.Command {
 						if err = unstructured.SetNestedField(ri.Object.UnstructuredContent(), kubernetesVersion, "spec", "controlPlaneVersion"); err != nil {
 							return err
 						}
-						if err = unstructured.SetNestedField(ri.Object.UnstructuredContent(), "stable", "spec", "releaseChannel"); err != nil {
+					}
+					if releaseChannel != "" {
+						if err = SetGCPReleaseChannel(ri, releaseChannel, validateReleaseChannel); err != nil {
 							return err
 						}
 					}
@@ -117,11 +686,29 @@ func NewCmdCAPG() *cobra.Command {
 			if !foundCP {
 				return errors.New("control plane not found, check apiVersion")
 			}
-			if !foundMP {
-				return errors.New("MachinePool not found")
+			if selfManaged {
+				if !foundCPTemplate {
+					return errors.New("GCPMachineTemplate of KubeadmControlPlane not found")
+				}
+				if !foundWorkerTemplate {
+					return errors.New("worker GCPMachineTemplate not found")
+				}
+			} else {
+				if !foundMP {
+					return errors.New("MachinePool not found")
+				}
+				if !foundManagedMP {
+					return errors.New("GCPManagedMachinePool not found")
+				}
+			}
+			if secondaryRanges.isSet() && !foundManagedCP {
+				return errors.New("failed to get GCPManagedControlPlane for IP allocation policy")
 			}
-			if !foundManagedMP {
-				return errors.New("GCPManagedMachinePool not found")
+			if workloadIdentity && !foundManagedCP {
+				return errors.New("failed to get GCPManagedControlPlane for workload identity configuration")
+			}
+			if privateCluster.isSet() && !foundManagedCP {
+				return errors.New("failed to get GCPManagedControlPlane for private cluster configuration")
 			}
 			_, err = os.Stdout.Write(out.Bytes())
 			return err
@@ -129,9 +716,27 @@ func NewCmdCAPG() *cobra.Command {
 	}
 	cmd.Flags().Int64Var(&minSize, "min-count", 3, "Minimum count of nodes in nodepool")
 	cmd.Flags().Int64Var(&maxSize, "max-count", 6, "Maximum count of nodes in nodepool")
+	cmd.Flags().Int64Var(&controlPlaneReplicas, "control-plane-replicas", 0, "Count of control plane machines of self-managed clusters, 0 keeps the template value")
 	return cmd
 }
 
+func SetGCPReleaseChannel(ri parser.ResourceInfo, releaseChannel string, validateVersion bool) error {
+	if releaseChannel == gkeReleaseChannelNone {
+		unstructured.RemoveNestedField(ri.Object.UnstructuredContent(), "spec", "releaseChannel")
+	} else if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), releaseChannel, "spec", "releaseChannel"); err != nil {
+		return err
+	}
+	if !validateVersion {
+		return nil
+	}
+
+	version, _, err := unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "controlPlaneVersion")
+	if err != nil {
+		return err
+	}
+	return validateGKEReleaseChannelVersion(releaseChannel, version)
+}
+
 func SetGCPManagedMPConfiguration(ri parser.ResourceInfo, name string, minSize int64, maxSize int64) error {
 	scalingCfg := map[string]any{
 		"minCount": minSize,
@@ -164,13 +769,12 @@ func SetGCPNetworkConfiguration(ri parser.ResourceInfo, subnetCidr string) error
 		return errors.New("region name is missing")
 	}
 
-	subnets := []interface{}{
-		map[string]any{
-			"name":      networkName + "-subnet",
-			"region":    region,
-			"cidrBlock": subnetCidr,
-		},
+	subnet := map[string]any{
+		"name":      networkName + "-subnet",
+		"region":    region,
+		"cidrBlock": subnetCidr,
 	}
+	subnets := []interface{}{subnet}
 
 	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), false, "spec", "network", "autoCreateSubnetworks"); err != nil {
 		return err
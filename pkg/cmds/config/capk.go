@@ -18,13 +18,18 @@ package config
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilvalidation "k8s.io/apimachinery/pkg/util/validation"
 	"kmodules.xyz/client-go/tools/parser"
 	"sigs.k8s.io/yaml"
 )
@@ -34,6 +39,230 @@ type machineSpecs struct {
 	memory               string
 }
 
+const (
+	kubevirtBindingBridge     = "bridge"
+	kubevirtBindingMasquerade = "masquerade"
+	kubevirtBindingSRIOV      = "sriov"
+	defaultKubevirtModel      = "virtio"
+)
+
+var kubevirtBindings = []string{kubevirtBindingBridge, kubevirtBindingMasquerade, kubevirtBindingSRIOV}
+
+// kubevirtNetwork is a vm interface and the network it is attached to. Without a networkName the
+// interface is attached to the pod network, otherwise to the multus network networkNamespace/networkName.
+type kubevirtNetwork struct {
+	Name             string `json:"name"`
+	Binding          string `json:"binding,omitempty"`
+	Model            string `json:"model,omitempty"`
+	NetworkName      string `json:"networkName,omitempty"`
+	NetworkNamespace string `json:"networkNamespace,omitempty"`
+	MacAddress       string `json:"macAddress,omitempty"`
+}
+
+// defaultKubevirtNetworks keeps the pod network along with the default/vmnet multus network.
+var defaultKubevirtNetworks = []kubevirtNetwork{
+	{
+		Name:    "default",
+		Binding: kubevirtBindingBridge,
+		Model:   defaultKubevirtModel,
+	},
+	{
+		Name:             "secondary",
+		Binding:          kubevirtBindingBridge,
+		Model:            defaultKubevirtModel,
+		NetworkName:      "vmnet",
+		NetworkNamespace: "default",
+	},
+}
+
+// parseKubevirtNetworks parses a yaml or json list of networks, e.g. `[{"name": "default", "binding": "masquerade"}]`.
+func parseKubevirtNetworks(s string) ([]kubevirtNetwork, error) {
+	if s == "" {
+		return defaultKubevirtNetworks, nil
+	}
+	var networks []kubevirtNetwork
+	if err := yaml.UnmarshalStrict([]byte(s), &networks); err != nil {
+		return nil, fmt.Errorf("failed to parse kubevirt networks: %w", err)
+	}
+	if len(networks) == 0 {
+		return nil, errors.New("at least one kubevirt network is required")
+	}
+
+	names := map[string]bool{}
+	podNetworks := 0
+	for i := range networks {
+		nw := &networks[i]
+		if errs := utilvalidation.IsDNS1123Label(nw.Name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid kubevirt network name %q: %s", nw.Name, strings.Join(errs, "; "))
+		}
+		if names[nw.Name] {
+			return nil, fmt.Errorf("duplicate kubevirt network %q", nw.Name)
+		}
+		names[nw.Name] = true
+
+		if nw.Binding == "" {
+			nw.Binding = kubevirtBindingBridge
+		}
+		if err := validateOneOf("kubevirt network binding", nw.Binding, kubevirtBindings); err != nil {
+			return nil, err
+		}
+		if nw.Binding == kubevirtBindingSRIOV {
+			if nw.Model != "" {
+				return nil, fmt.Errorf("model can't be set for sriov network %q", nw.Name)
+			}
+		} else if nw.Model == "" {
+			nw.Model = defaultKubevirtModel
+		}
+
+		if nw.NetworkName == "" {
+			if nw.NetworkNamespace != "" {
+				return nil, fmt.Errorf("networkNamespace requires a networkName for kubevirt network %q", nw.Name)
+			}
+			if nw.Binding == kubevirtBindingSRIOV {
+				return nil, fmt.Errorf("sriov binding requires a multus network for kubevirt network %q", nw.Name)
+			}
+			podNetworks++
+		} else {
+			if errs := utilvalidation.IsDNS1123Subdomain(nw.NetworkName); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid multus network name %q: %s", nw.NetworkName, strings.Join(errs, "; "))
+			}
+			if nw.NetworkNamespace != "" {
+				if errs := utilvalidation.IsDNS1123Label(nw.NetworkNamespace); len(errs) > 0 {
+					return nil, fmt.Errorf("invalid multus network namespace %q: %s", nw.NetworkNamespace, strings.Join(errs, "; "))
+				}
+			}
+			if nw.Binding == kubevirtBindingMasquerade {
+				return nil, fmt.Errorf("masquerade binding is only supported on the pod network, found on kubevirt network %q", nw.Name)
+			}
+		}
+
+		if nw.MacAddress != "" {
+			if _, err := net.ParseMAC(nw.MacAddress); err != nil {
+				return nil, fmt.Errorf("invalid mac address %q for kubevirt network %q: %w", nw.MacAddress, nw.Name, err)
+			}
+		}
+	}
+	if podNetworks > 1 {
+		return nil, errors.New("only one kubevirt network can use the pod network")
+	}
+	return networks, nil
+}
+
+func (nw kubevirtNetwork) multusNetworkName() string {
+	if nw.NetworkNamespace == "" {
+		return nw.NetworkName
+	}
+	return nw.NetworkNamespace + "/" + nw.NetworkName
+}
+
+const (
+	kubevirtSourceRegistry   = "registry"
+	kubevirtSourceHTTP       = "http"
+	kubevirtSourcePVC        = "pvc"
+	kubevirtSourceDataSource = "datasource"
+)
+
+var (
+	kubevirtSourceTypes = []string{kubevirtSourceRegistry, kubevirtSourceHTTP, kubevirtSourcePVC, kubevirtSourceDataSource}
+	kubevirtAccessModes = []string{"ReadWriteOnce", "ReadWriteMany", "ReadOnlyMany", "ReadWriteOncePod"}
+	kubevirtVolumeModes = []string{"Filesystem", "Block"}
+)
+
+// bootDiskSource is where the boot volume is imported from. The image is a container image for
+// registry sources, an url for http sources and namespace/name of a PVC or DataSource otherwise.
+type bootDiskSource struct {
+	sourceType string
+	image      string
+}
+
+func bootDiskSourceFromEnv() (*bootDiskSource, error) {
+	src := &bootDiskSource{
+		sourceType: os.Getenv("NODE_VM_IMAGE_SOURCE_TYPE"),
+		image:      os.Getenv("NODE_VM_IMAGE_TEMPLATE"),
+	}
+	if src.sourceType == "" {
+		src.sourceType = kubevirtSourceRegistry
+	}
+	if err := validateOneOf("NODE_VM_IMAGE_SOURCE_TYPE", src.sourceType, kubevirtSourceTypes); err != nil {
+		return nil, err
+	}
+	if src.image == "" {
+		return nil, errors.New("NODE_VM_IMAGE_TEMPLATE is required")
+	}
+
+	switch src.sourceType {
+	case kubevirtSourceHTTP:
+		u, err := url.Parse(src.image)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid http image url %q", src.image)
+		}
+	case kubevirtSourcePVC, kubevirtSourceDataSource:
+		namespace, name, _ := src.namespaceName()
+		if src.sourceType == kubevirtSourcePVC && namespace == "" {
+			return nil, fmt.Errorf("pvc image source %q must be in namespace/name format", src.image)
+		}
+		if namespace != "" {
+			if errs := utilvalidation.IsDNS1123Label(namespace); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid image source namespace %q: %s", namespace, strings.Join(errs, "; "))
+			}
+		}
+		if errs := utilvalidation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid image source name %q: %s", name, strings.Join(errs, "; "))
+		}
+	}
+	return src, nil
+}
+
+func (src *bootDiskSource) namespaceName() (string, string, bool) {
+	namespace, name, found := strings.Cut(src.image, "/")
+	if !found {
+		return "", src.image, false
+	}
+	return namespace, name, true
+}
+
+type bootDiskOptions struct {
+	size         string
+	storageClass string
+	accessMode   string
+	volumeMode   string
+}
+
+// bootDiskOptionsFromEnv reads the boot disk of a machine role, e.g. WORKER_MACHINE_DISK_SIZE for the WORKER_MACHINE prefix.
+func bootDiskOptionsFromEnv(prefix string) (*bootDiskOptions, error) {
+	opts := &bootDiskOptions{
+		size:         "20Gi",
+		storageClass: "hvl",
+		accessMode:   "ReadWriteOnce",
+		volumeMode:   os.Getenv(prefix + "_DISK_VOLUME_MODE"),
+	}
+	if v := os.Getenv(prefix + "_DISK_SIZE"); v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid %s_DISK_SIZE %q, must be a positive size in Gi", prefix, v)
+		}
+		opts.size = v + "Gi"
+	}
+	if v := os.Getenv(prefix + "_STORAGE_CLASS"); v != "" {
+		if errs := utilvalidation.IsDNS1123Subdomain(v); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid %s_STORAGE_CLASS %q: %s", prefix, v, strings.Join(errs, "; "))
+		}
+		opts.storageClass = v
+	}
+	if v := os.Getenv(prefix + "_DISK_ACCESS_MODE"); v != "" {
+		if err := validateOneOf(prefix+"_DISK_ACCESS_MODE", v, kubevirtAccessModes); err != nil {
+			return nil, err
+		}
+		opts.accessMode = v
+	}
+	if opts.volumeMode != "" {
+		if err := validateOneOf(prefix+"_DISK_VOLUME_MODE", opts.volumeMode, kubevirtVolumeModes); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
 func NewCmdCAPK() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:               "capk",
@@ -46,7 +275,18 @@ func NewCmdCAPK() *cobra.Command {
 			}
 
 			var out bytes.Buffer
-			vmImage := os.Getenv("NODE_VM_IMAGE_TEMPLATE")
+			bootSource, err := bootDiskSourceFromEnv()
+			if err != nil {
+				return err
+			}
+			cpDisk, err := bootDiskOptionsFromEnv("CONTROL_PLANE_MACHINE")
+			if err != nil {
+				return err
+			}
+			wmDisk, err := bootDiskOptionsFromEnv("WORKER_MACHINE")
+			if err != nil {
+				return err
+			}
 			clusterName := os.Getenv("CLUSTER_NAME")
 			cpCPU, err := strconv.ParseInt(os.Getenv("CONTROL_PLANE_MACHINE_CPU"), 10, 64)
 			if err != nil {
@@ -58,6 +298,10 @@ func NewCmdCAPK() *cobra.Command {
 				return err
 			}
 			wmMemory := os.Getenv("WORKER_MACHINE_MEMORY") + "Gi"
+			networks, err := parseKubevirtNetworks(os.Getenv("KUBEVIRT_NETWORKS"))
+			if err != nil {
+				return err
+			}
 
 			err = parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
 				if ri.Object.GetAPIVersion() == "infrastructure.cluster.x-k8s.io/v1alpha1" &&
@@ -72,11 +316,11 @@ func NewCmdCAPK() *cobra.Command {
 						return err
 					}
 
-					if err := addInterfaces(ri); err != nil {
+					if err := addInterfaces(ri, networks); err != nil {
 						return err
 					}
 
-					if err := addNetworks(ri); err != nil {
+					if err := addNetworks(ri, networks); err != nil {
 						return err
 					}
 
@@ -89,6 +333,10 @@ func NewCmdCAPK() *cobra.Command {
 						}); err != nil {
 							return err
 						}
+
+						if err := setBootVolume(ri, clusterName+"-control-plane-boot-volume", bootSource, cpDisk); err != nil {
+							return err
+						}
 					} else {
 						if err := setWorkerMachineCpuMemory(ri, &machineSpecs{
 							cpu:     wmCPU,
@@ -99,15 +347,7 @@ func NewCmdCAPK() *cobra.Command {
 							return err
 						}
 
-						if err := replaceVolumes(ri, clusterName); err != nil {
-							return err
-						}
-
-						if err := addDataVolumeTemplates(ri, clusterName, vmImage); err != nil {
-							return err
-						}
-
-						if err := replaceDisks(ri); err != nil {
+						if err := setBootVolume(ri, clusterName+"-md-0-boot-volume", bootSource, wmDisk); err != nil {
 							return err
 						}
 					}
@@ -135,18 +375,20 @@ func NewCmdCAPK() *cobra.Command {
 	return cmd
 }
 
-func addInterfaces(ri parser.ResourceInfo) error {
-	interfaces := []interface{}{
-		map[string]interface{}{
-			"bridge": map[string]interface{}{},
-			"model":  "virtio",
-			"name":   "default",
-		},
-		map[string]interface{}{
-			"bridge": map[string]interface{}{},
-			"model":  "virtio",
-			"name":   "secondary",
-		},
+func addInterfaces(ri parser.ResourceInfo, networks []kubevirtNetwork) error {
+	interfaces := make([]interface{}, 0, len(networks))
+	for _, nw := range networks {
+		iface := map[string]interface{}{
+			nw.Binding: map[string]interface{}{},
+			"name":     nw.Name,
+		}
+		if nw.Model != "" {
+			iface["model"] = nw.Model
+		}
+		if nw.MacAddress != "" {
+			iface["macAddress"] = nw.MacAddress
+		}
+		interfaces = append(interfaces, iface)
 	}
 
 	if err := unstructured.SetNestedSlice(ri.Object.UnstructuredContent(), interfaces, "spec", "template", "spec", "virtualMachineTemplate", "spec",
@@ -156,21 +398,25 @@ func addInterfaces(ri parser.ResourceInfo) error {
 	return nil
 }
 
-func addNetworks(ri parser.ResourceInfo) error {
-	networks := []interface{}{
-		map[string]interface{}{
-			"pod":  map[string]interface{}{},
-			"name": "default",
-		},
-		map[string]interface{}{
+func addNetworks(ri parser.ResourceInfo, networks []kubevirtNetwork) error {
+	vmNetworks := make([]interface{}, 0, len(networks))
+	for _, nw := range networks {
+		if nw.NetworkName == "" {
+			vmNetworks = append(vmNetworks, map[string]interface{}{
+				"pod":  map[string]interface{}{},
+				"name": nw.Name,
+			})
+			continue
+		}
+		vmNetworks = append(vmNetworks, map[string]interface{}{
 			"multus": map[string]interface{}{
-				"networkName": "default/vmnet",
+				"networkName": nw.multusNetworkName(),
 			},
-			"name": "secondary",
-		},
+			"name": nw.Name,
+		})
 	}
 
-	if err := unstructured.SetNestedSlice(ri.Object.UnstructuredContent(), networks, "spec", "template", "spec", "virtualMachineTemplate", "spec",
+	if err := unstructured.SetNestedSlice(ri.Object.UnstructuredContent(), vmNetworks, "spec", "template", "spec", "virtualMachineTemplate", "spec",
 		"template", "spec", "networks"); err != nil {
 		return err
 	}
@@ -178,28 +424,78 @@ func addNetworks(ri parser.ResourceInfo) error {
 	return nil
 }
 
-func addDataVolumeTemplates(ri parser.ResourceInfo, clusterName string, vmImage string) error {
+func setBootVolume(ri parser.ResourceInfo, volumeName string, src *bootDiskSource, disk *bootDiskOptions) error {
+	if err := replaceVolumes(ri, volumeName); err != nil {
+		return err
+	}
+
+	if err := addDataVolumeTemplates(ri, volumeName, src, disk); err != nil {
+		return err
+	}
+
+	return replaceDisks(ri)
+}
+
+func addDataVolumeTemplates(ri parser.ResourceInfo, volumeName string, src *bootDiskSource, disk *bootDiskOptions) error {
+	pvc := map[string]interface{}{
+		"accessModes": []interface{}{disk.accessMode},
+		"resources": map[string]interface{}{
+			"requests": map[string]interface{}{
+				"storage": disk.size,
+			},
+		},
+		"storageClassName": disk.storageClass,
+	}
+	if disk.volumeMode != "" {
+		pvc["volumeMode"] = disk.volumeMode
+	}
+	spec := map[string]interface{}{
+		"pvc": pvc,
+	}
+
+	switch src.sourceType {
+	case kubevirtSourceRegistry:
+		image := src.image
+		if !strings.Contains(image, "://") {
+			image = "docker://" + image
+		}
+		spec["source"] = map[string]interface{}{
+			"registry": map[string]interface{}{
+				"url": image,
+			},
+		}
+	case kubevirtSourceHTTP:
+		spec["source"] = map[string]interface{}{
+			"http": map[string]interface{}{
+				"url": src.image,
+			},
+		}
+	case kubevirtSourcePVC:
+		namespace, name, _ := src.namespaceName()
+		spec["source"] = map[string]interface{}{
+			"pvc": map[string]interface{}{
+				"namespace": namespace,
+				"name":      name,
+			},
+		}
+	case kubevirtSourceDataSource:
+		namespace, name, found := src.namespaceName()
+		sourceRef := map[string]interface{}{
+			"kind": "DataSource",
+			"name": name,
+		}
+		if found {
+			sourceRef["namespace"] = namespace
+		}
+		spec["sourceRef"] = sourceRef
+	}
+
 	dataVolumeTemplates := []interface{}{
 		map[string]interface{}{
 			"metadata": map[string]interface{}{
-				"name": clusterName + "-md-0-boot-volume",
-			},
-			"spec": map[string]interface{}{
-				"pvc": map[string]interface{}{
-					"accessModes": []interface{}{"ReadWriteOnce"},
-					"resources": map[string]interface{}{
-						"requests": map[string]interface{}{
-							"storage": "20Gi",
-						},
-					},
-					"storageClassName": "hvl",
-				},
-				"source": map[string]interface{}{
-					"registry": map[string]interface{}{
-						"url": "docker://" + vmImage,
-					},
-				},
+				"name": volumeName,
 			},
+			"spec": spec,
 		},
 	}
 
@@ -229,11 +525,11 @@ func replaceDisks(ri parser.ResourceInfo) error {
 	return nil
 }
 
-func replaceVolumes(ri parser.ResourceInfo, clusterName string) error {
+func replaceVolumes(ri parser.ResourceInfo, volumeName string) error {
 	volumes := []interface{}{
 		map[string]interface{}{
 			"dataVolume": map[string]interface{}{
-				"name": clusterName + "-md-0-boot-volume",
+				"name": volumeName,
 			},
 			"name": "dv-volume",
 		},
@@ -19,17 +19,873 @@ package config
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	_ "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilvalidation "k8s.io/apimachinery/pkg/util/validation"
 	"kmodules.xyz/client-go/tools/parser"
 	"sigs.k8s.io/yaml"
 )
 
+const (
+	azureManagedControlPlaneKind = "AzureManagedControlPlane"
+	azureManagedMachinePoolKind  = "AzureManagedMachinePool"
+	azureClusterIdentityKind     = "AzureClusterIdentity"
+)
+
+var (
+	azureVNetNamePattern      = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,62}[a-zA-Z0-9_]$`)
+	azureSubnetNamePattern    = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9_.-]{0,78}[a-zA-Z0-9_])?$`)
+	azureResourceGroupPattern = regexp.MustCompile(`^[-\w._()]{0,89}[-\w_()]$`)
+)
+
+var (
+	azureNetworkPlugins    = []string{"azure", "kubenet", "none"}
+	azureNetworkPolicies   = []string{"azure", "calico", "cilium"}
+	azureNetworkDataplanes = []string{"azure", "cilium"}
+	azureOutboundTypes     = []string{"loadBalancer", "managedNATGateway", "userAssignedNATGateway", "userDefinedRouting"}
+)
+
+type azureNetworkProfile struct {
+	plugin       string
+	pluginMode   string
+	policy       string
+	dataplane    string
+	outboundType string
+	dnsServiceIP string
+	serviceCIDR  string
+}
+
+func azureNetworkProfileFromEnv() (*azureNetworkProfile, error) {
+	np := &azureNetworkProfile{
+		plugin:       os.Getenv("AKS_NETWORK_PLUGIN"),
+		pluginMode:   os.Getenv("AKS_NETWORK_PLUGIN_MODE"),
+		policy:       os.Getenv("AKS_NETWORK_POLICY"),
+		dataplane:    os.Getenv("AKS_NETWORK_DATAPLANE"),
+		outboundType: os.Getenv("AKS_OUTBOUND_TYPE"),
+		dnsServiceIP: os.Getenv("AKS_DNS_SERVICE_IP"),
+		serviceCIDR:  os.Getenv("AKS_SERVICE_CIDR"),
+	}
+	return np, np.validate()
+}
+
+func (np *azureNetworkProfile) validate() error {
+	if err := validateOneOf("network plugin", np.plugin, azureNetworkPlugins); err != nil {
+		return err
+	}
+	if err := validateOneOf("network policy", np.policy, azureNetworkPolicies); err != nil {
+		return err
+	}
+	if err := validateOneOf("network dataplane", np.dataplane, azureNetworkDataplanes); err != nil {
+		return err
+	}
+	if err := validateOneOf("outbound type", np.outboundType, azureOutboundTypes); err != nil {
+		return err
+	}
+	if np.pluginMode != "" {
+		if np.pluginMode != "overlay" {
+			return fmt.Errorf("invalid network plugin mode %q, must be overlay", np.pluginMode)
+		}
+		if np.plugin != "azure" {
+			return errors.New("network plugin mode overlay requires the azure network plugin")
+		}
+	}
+	if np.plugin == "none" && np.policy != "" {
+		return errors.New("network policy can't be set when network plugin is none")
+	}
+	if np.plugin == "kubenet" && np.policy == "azure" {
+		return errors.New("azure network policy is not supported with the kubenet network plugin")
+	}
+	if np.dataplane == "cilium" || np.policy == "cilium" {
+		if np.dataplane != "cilium" || np.policy != "cilium" {
+			return errors.New("cilium network policy and cilium network dataplane must be used together")
+		}
+		if np.plugin != "azure" {
+			return errors.New("cilium network dataplane requires the azure network plugin")
+		}
+	}
+
+	if np.dnsServiceIP != "" && np.serviceCIDR == "" {
+		return errors.New("service CIDR is required when DNS service IP is set")
+	}
+	if np.serviceCIDR != "" {
+		_, serviceNet, err := net.ParseCIDR(np.serviceCIDR)
+		if err != nil {
+			return fmt.Errorf("invalid service CIDR %q: %w", np.serviceCIDR, err)
+		}
+		if np.dnsServiceIP != "" {
+			dnsIP := net.ParseIP(np.dnsServiceIP)
+			if dnsIP == nil {
+				return fmt.Errorf("invalid DNS service IP %q", np.dnsServiceIP)
+			}
+			if !serviceNet.Contains(dnsIP) {
+				return fmt.Errorf("DNS service IP %s is not within service CIDR %s", np.dnsServiceIP, np.serviceCIDR)
+			}
+			if dnsIP.Equal(serviceNet.IP) {
+				return fmt.Errorf("DNS service IP %s can't be the network address of service CIDR %s", np.dnsServiceIP, np.serviceCIDR)
+			}
+		}
+	}
+	return nil
+}
+
+func SetAzureNetworkProfile(ri parser.ResourceInfo, np *azureNetworkProfile) error {
+	fields := map[string]string{
+		"networkPlugin":     np.plugin,
+		"networkPluginMode": np.pluginMode,
+		"networkPolicy":     np.policy,
+		"networkDataplane":  np.dataplane,
+		"outboundType":      np.outboundType,
+		"dnsServiceIP":      np.dnsServiceIP,
+	}
+	for field, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), value, "spec", field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const azureMaxAuthorizedIPRanges = 200
+
+var azurePrivateDNSZoneIDPattern = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/resourceGroups/[^/]+/providers/Microsoft\.Network/privateDnsZones/([a-z0-9-]+\.)?privatelink\.[a-z0-9]+\.azmk8s\.io$`)
+
+type azureAPIServerAccessProfile struct {
+	privateCluster     bool
+	privateClusterSet  bool
+	privateDNSZone     string
+	publicFQDN         bool
+	authorizedIPRanges []string
+}
+
+func azureAPIServerAccessProfileFromEnv() (*azureAPIServerAccessProfile, error) {
+	ap := &azureAPIServerAccessProfile{
+		privateDNSZone:     os.Getenv("AKS_PRIVATE_DNS_ZONE"),
+		authorizedIPRanges: splitList(os.Getenv("AKS_AUTHORIZED_IP_RANGES")),
+	}
+	var err error
+	if v := os.Getenv("AKS_PRIVATE_CLUSTER"); v != "" {
+		if ap.privateCluster, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid AKS_PRIVATE_CLUSTER %q: %w", v, err)
+		}
+		ap.privateClusterSet = true
+	}
+	if v := os.Getenv("AKS_PRIVATE_CLUSTER_PUBLIC_FQDN"); v != "" {
+		if ap.publicFQDN, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid AKS_PRIVATE_CLUSTER_PUBLIC_FQDN %q: %w", v, err)
+		}
+	}
+	// the profile is validated once merged with the AzureManagedControlPlane
+	return ap, nil
+}
+
+func (ap *azureAPIServerAccessProfile) isSet() bool {
+	return ap.privateClusterSet || ap.privateDNSZone != "" || ap.publicFQDN || len(ap.authorizedIPRanges) > 0
+}
+
+func (ap *azureAPIServerAccessProfile) validate() error {
+	if !ap.privateCluster {
+		if ap.privateDNSZone != "" {
+			return errors.New("private DNS zone can only be set for private clusters")
+		}
+		if ap.publicFQDN {
+			return errors.New("public FQDN can only be enabled for private clusters")
+		}
+	} else {
+		if len(ap.authorizedIPRanges) > 0 {
+			return errors.New("authorized IP ranges are not supported for private clusters")
+		}
+		switch strings.ToLower(ap.privateDNSZone) {
+		case "", "system":
+		case "none":
+			if !ap.publicFQDN {
+				return errors.New("private DNS zone none requires the public FQDN to be enabled")
+			}
+		default:
+			if !azurePrivateDNSZoneIDPattern.MatchString(ap.privateDNSZone) {
+				return fmt.Errorf("invalid private DNS zone %q, must be system, none or a privatelink.<region>.azmk8s.io zone resource ID", ap.privateDNSZone)
+			}
+		}
+	}
+
+	if len(ap.authorizedIPRanges) > azureMaxAuthorizedIPRanges {
+		return fmt.Errorf("at most %d authorized IP ranges are allowed, found %d", azureMaxAuthorizedIPRanges, len(ap.authorizedIPRanges))
+	}
+	for _, r := range ap.authorizedIPRanges {
+		if _, _, err := net.ParseCIDR(r); err != nil && net.ParseIP(r) == nil {
+			return fmt.Errorf("invalid authorized IP range %q", r)
+		}
+	}
+	return nil
+}
+
+// SetAzureAPIServerAccessProfile merges the configured access profile into the one of the AzureManagedControlPlane
+// and validates the result. Settings that only apply to private clusters are removed when the cluster is not private.
+func SetAzureAPIServerAccessProfile(ri parser.ResourceInfo, ap *azureAPIServerAccessProfile) error {
+	profile, _, err := unstructured.NestedMap(ri.Object.UnstructuredContent(), "spec", "apiServerAccessProfile")
+	if err != nil {
+		return err
+	}
+	if profile == nil {
+		profile = make(map[string]any)
+	}
+
+	merged := *ap
+	if !merged.privateClusterSet {
+		merged.privateCluster, _, err = unstructured.NestedBool(profile, "enablePrivateCluster")
+		if err != nil {
+			return err
+		}
+	}
+	if merged.privateCluster {
+		if merged.privateDNSZone == "" {
+			if merged.privateDNSZone, _, err = unstructured.NestedString(profile, "privateDNSZone"); err != nil {
+				return err
+			}
+		}
+		if !merged.publicFQDN {
+			if merged.publicFQDN, _, err = unstructured.NestedBool(profile, "enablePrivateClusterPublicFQDN"); err != nil {
+				return err
+			}
+		}
+	}
+	if len(merged.authorizedIPRanges) == 0 {
+		if merged.authorizedIPRanges, _, err = unstructured.NestedStringSlice(profile, "authorizedIPRanges"); err != nil {
+			return err
+		}
+	}
+	if err := merged.validate(); err != nil {
+		return err
+	}
+
+	delete(profile, "enablePrivateCluster")
+	delete(profile, "privateDNSZone")
+	delete(profile, "enablePrivateClusterPublicFQDN")
+	delete(profile, "authorizedIPRanges")
+	if merged.privateCluster {
+		profile["enablePrivateCluster"] = true
+		if merged.privateDNSZone != "" {
+			profile["privateDNSZone"] = merged.privateDNSZone
+		}
+		if merged.publicFQDN {
+			profile["enablePrivateClusterPublicFQDN"] = true
+		}
+	}
+	if len(merged.authorizedIPRanges) > 0 {
+		ranges := make([]interface{}, 0, len(merged.authorizedIPRanges))
+		for _, r := range merged.authorizedIPRanges {
+			ranges = append(ranges, r)
+		}
+		profile["authorizedIPRanges"] = ranges
+	}
+	if len(profile) == 0 {
+		unstructured.RemoveNestedField(ri.Object.UnstructuredContent(), "spec", "apiServerAccessProfile")
+		return nil
+	}
+	return unstructured.SetNestedMap(ri.Object.UnstructuredContent(), profile, "spec", "apiServerAccessProfile")
+}
+
+var (
+	azureAutoscalerExpanders = []string{"least-waste", "most-pods", "priority", "random"}
+	azureUpgradeChannels     = []string{"node-image", "none", "patch", "rapid", "stable"}
+	azureSecondsPattern      = regexp.MustCompile(`^\d+s$`)
+	azureMinutesPattern      = regexp.MustCompile(`^\d+m$`)
+
+	// the AKS api accepts a single unit for each autoscaler duration
+	azureAutoscalerDurationPatterns = map[string]*regexp.Regexp{
+		"scanInterval":               azureSecondsPattern,
+		"scaleDownDelayAfterAdd":     azureMinutesPattern,
+		"scaleDownDelayAfterDelete":  azureSecondsPattern,
+		"scaleDownDelayAfterFailure": azureMinutesPattern,
+		"scaleDownUnneededTime":      azureMinutesPattern,
+	}
+)
+
+type azureAutoscalerProfile struct {
+	scanInterval               string
+	scaleDownDelayAfterAdd     string
+	scaleDownDelayAfterDelete  string
+	scaleDownDelayAfterFailure string
+	scaleDownUnneededTime      string
+	expander                   string
+	balanceSimilarNodeGroups   string
+}
+
+func azureAutoscalerProfileFromEnv() (*azureAutoscalerProfile, error) {
+	ap := &azureAutoscalerProfile{
+		scanInterval:               os.Getenv("AKS_AUTOSCALER_SCAN_INTERVAL"),
+		scaleDownDelayAfterAdd:     os.Getenv("AKS_AUTOSCALER_SCALE_DOWN_DELAY_AFTER_ADD"),
+		scaleDownDelayAfterDelete:  os.Getenv("AKS_AUTOSCALER_SCALE_DOWN_DELAY_AFTER_DELETE"),
+		scaleDownDelayAfterFailure: os.Getenv("AKS_AUTOSCALER_SCALE_DOWN_DELAY_AFTER_FAILURE"),
+		scaleDownUnneededTime:      os.Getenv("AKS_AUTOSCALER_SCALE_DOWN_UNNEEDED_TIME"),
+		expander:                   os.Getenv("AKS_AUTOSCALER_EXPANDER"),
+	}
+	if v := os.Getenv("AKS_AUTOSCALER_BALANCE_SIMILAR_NODE_GROUPS"); v != "" {
+		balance, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AKS_AUTOSCALER_BALANCE_SIMILAR_NODE_GROUPS %q: %w", v, err)
+		}
+		// the AKS api expects the string "true" or "false"
+		ap.balanceSimilarNodeGroups = strconv.FormatBool(balance)
+	}
+
+	if err := validateOneOf("autoscaler expander", ap.expander, azureAutoscalerExpanders); err != nil {
+		return nil, err
+	}
+	for name, d := range ap.durations() {
+		if d == "" || azureAutoscalerDurationPatterns[name].MatchString(d) {
+			continue
+		}
+		if azureAutoscalerDurationPatterns[name] == azureSecondsPattern {
+			return nil, fmt.Errorf("invalid autoscaler %s %q, expected a duration in seconds like 10s", name, d)
+		}
+		return nil, fmt.Errorf("invalid autoscaler %s %q, expected a duration in minutes like 10m", name, d)
+	}
+	return ap, nil
+}
+
+func (ap *azureAutoscalerProfile) durations() map[string]string {
+	return map[string]string{
+		"scanInterval":               ap.scanInterval,
+		"scaleDownDelayAfterAdd":     ap.scaleDownDelayAfterAdd,
+		"scaleDownDelayAfterDelete":  ap.scaleDownDelayAfterDelete,
+		"scaleDownDelayAfterFailure": ap.scaleDownDelayAfterFailure,
+		"scaleDownUnneededTime":      ap.scaleDownUnneededTime,
+	}
+}
+
+func SetAzureAutoscalerProfile(ri parser.ResourceInfo, ap *azureAutoscalerProfile) error {
+	fields := ap.durations()
+	fields["expander"] = ap.expander
+	fields["balanceSimilarNodeGroups"] = ap.balanceSimilarNodeGroups
+	for field, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), value, "spec", "autoscalerProfile", field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	azureOSTypeWindows     = "Windows"
+	defaultSystemPoolName  = "sys0"
+	defaultWindowsPoolName = "win0"
+)
+
+var (
+	azurePoolNamePattern        = regexp.MustCompile(`^[a-z][a-z0-9]{0,11}$`)
+	azureWindowsPoolNamePattern = regexp.MustCompile(`^[a-z][a-z0-9]{0,5}$`)
+	azureMaxSurgePattern        = regexp.MustCompile(`^([1-9][0-9]*|([1-9][0-9]?|100)%)$`)
+	azureAvailabilityZones      = []string{"1", "2", "3"}
+	azureOSDiskTypes            = []string{"Ephemeral", "Managed"}
+	azureOSTypes                = []string{"Linux", "Windows"}
+
+	// the system pool is tainted so that only critical addons are scheduled there, unless other taints are configured
+	defaultSystemPoolTaints = []nodeTaint{{key: "CriticalAddonsOnly", value: "true", effect: "NoSchedule"}}
+)
+
+type azureMachinePoolOptions struct {
+	name              string
+	sku               string
+	availabilityZones []string
+	osDiskSizeGB      int64
+	osDiskType        string
+	osType            string
+	nodeLabels        map[string]string
+	maxPods           int64
+	taints            []nodeTaint
+	maxSurge          string
+}
+
+// azureMachinePoolOptionsFromEnv reads the machine pool settings from environment variables with the given prefix,
+// e.g. AKS_SYSTEM_POOL_SKU for prefix AKS_SYSTEM_POOL.
+func azureMachinePoolOptionsFromEnv(prefix string) (*azureMachinePoolOptions, error) {
+	opts := &azureMachinePoolOptions{
+		name:              os.Getenv(prefix + "_NAME"),
+		sku:               os.Getenv(prefix + "_SKU"),
+		availabilityZones: splitList(os.Getenv(prefix + "_AVAILABILITY_ZONES")),
+		osDiskType:        os.Getenv(prefix + "_OS_DISK_TYPE"),
+		osType:            os.Getenv(prefix + "_OS_TYPE"),
+		maxSurge:          os.Getenv(prefix + "_MAX_SURGE"),
+	}
+	var err error
+	if v := os.Getenv(prefix + "_OS_DISK_SIZE_GB"); v != "" {
+		if opts.osDiskSizeGB, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid %s_OS_DISK_SIZE_GB %q: %w", prefix, v, err)
+		}
+	}
+	if v := os.Getenv(prefix + "_MAX_PODS"); v != "" {
+		if opts.maxPods, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid %s_MAX_PODS %q: %w", prefix, v, err)
+		}
+	}
+	if opts.nodeLabels, err = parseNodeLabels(os.Getenv(prefix + "_NODE_LABELS")); err != nil {
+		return nil, err
+	}
+	if opts.taints, err = parseTaints(os.Getenv(prefix + "_TAINTS")); err != nil {
+		return nil, err
+	}
+	return opts, opts.validate()
+}
+
+func (opts *azureMachinePoolOptions) validate() error {
+	for _, zone := range opts.availabilityZones {
+		if err := validateOneOf("availability zone", zone, azureAvailabilityZones); err != nil {
+			return err
+		}
+	}
+	if err := validateOneOf("os disk type", opts.osDiskType, azureOSDiskTypes); err != nil {
+		return err
+	}
+	if err := validateOneOf("os type", opts.osType, azureOSTypes); err != nil {
+		return err
+	}
+	if opts.osDiskSizeGB != 0 && (opts.osDiskSizeGB < 30 || opts.osDiskSizeGB > 2048) {
+		return fmt.Errorf("os disk size must be between 30 and 2048 GB, found %d", opts.osDiskSizeGB)
+	}
+	if opts.maxPods != 0 && (opts.maxPods < 10 || opts.maxPods > 250) {
+		return fmt.Errorf("max pods must be between 10 and 250, found %d", opts.maxPods)
+	}
+	if opts.name != "" && !azurePoolNamePattern.MatchString(opts.name) {
+		return fmt.Errorf("invalid pool name %q, must be at most 12 lowercase alphanumeric characters starting with a letter", opts.name)
+	}
+	if opts.maxSurge != "" && !azureMaxSurgePattern.MatchString(opts.maxSurge) {
+		return fmt.Errorf("invalid max surge %q, must be a positive node count or percentage", opts.maxSurge)
+	}
+	for k := range opts.nodeLabels {
+		if strings.HasPrefix(k, "kubernetes.azure.com/") {
+			return fmt.Errorf("node label %s uses the reserved kubernetes.azure.com prefix", k)
+		}
+	}
+	return nil
+}
+
+// SetAzureWindowsMPConfiguration taints a windows pool so that only pods tolerating os=windows are
+// scheduled there. Nodes are already labeled kubernetes.io/os=windows for node selectors.
+func SetAzureWindowsMPConfiguration(ri parser.ResourceInfo) error {
+	taints, _, err := unstructured.NestedSlice(ri.Object.UnstructuredContent(), "spec", "taints")
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(taints, func(t interface{}) bool {
+		m, ok := t.(map[string]any)
+		return ok && m["key"] == "os"
+	}) {
+		taints = append(taints, map[string]any{
+			"key":    "os",
+			"value":  "windows",
+			"effect": "NoSchedule",
+		})
+	}
+	return unstructured.SetNestedSlice(ri.Object.UnstructuredContent(), taints, "spec", "taints")
+}
+
+func SetAzureManagedMPOptions(ri parser.ResourceInfo, opts *azureMachinePoolOptions) error {
+	obj := ri.Object.UnstructuredContent()
+	if opts.sku != "" {
+		if err := unstructured.SetNestedField(obj, opts.sku, "spec", "sku"); err != nil {
+			return err
+		}
+	}
+	if len(opts.availabilityZones) > 0 {
+		if err := unstructured.SetNestedStringSlice(obj, opts.availabilityZones, "spec", "availabilityZones"); err != nil {
+			return err
+		}
+	}
+	if opts.osDiskSizeGB != 0 {
+		if err := unstructured.SetNestedField(obj, opts.osDiskSizeGB, "spec", "osDiskSizeGB"); err != nil {
+			return err
+		}
+	}
+	if opts.osDiskType != "" {
+		if err := unstructured.SetNestedField(obj, opts.osDiskType, "spec", "osDiskType"); err != nil {
+			return err
+		}
+	}
+	if opts.osType != "" {
+		if err := unstructured.SetNestedField(obj, opts.osType, "spec", "osType"); err != nil {
+			return err
+		}
+	}
+	if opts.maxPods != 0 {
+		if err := unstructured.SetNestedField(obj, opts.maxPods, "spec", "maxPods"); err != nil {
+			return err
+		}
+	}
+	if opts.maxSurge != "" {
+		if err := unstructured.SetNestedField(obj, opts.maxSurge, "spec", "upgradeSettings", "maxSurge"); err != nil {
+			return err
+		}
+	}
+	if err := mergeNestedStringMap(obj, opts.nodeLabels, "spec", "nodeLabels"); err != nil {
+		return err
+	}
+	if err := mergeNestedTaints(obj, opts.taints, "spec", "taints"); err != nil {
+		return err
+	}
+	return nil
+}
+
+const (
+	azureIdentityServicePrincipal            = "ServicePrincipal"
+	azureIdentityManualServicePrincipal      = "ManualServicePrincipal"
+	azureIdentityServicePrincipalCertificate = "ServicePrincipalCertificate"
+	azureIdentityUserAssignedMSI             = "UserAssignedMSI"
+	azureIdentityWorkloadIdentity            = "WorkloadIdentity"
+)
+
+var (
+	azureIdentityTypes = []string{
+		azureIdentityServicePrincipal,
+		azureIdentityManualServicePrincipal,
+		azureIdentityServicePrincipalCertificate,
+		azureIdentityUserAssignedMSI,
+		azureIdentityWorkloadIdentity,
+	}
+	azureGUIDPattern                   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	azureUserAssignedIdentityIDPattern = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/resourceGroups/[^/]+/providers/Microsoft\.ManagedIdentity/userAssignedIdentities/[^/]+$`)
+)
+
+type azureClusterIdentity struct {
+	identityType          string
+	clientID              string
+	tenantID              string
+	resourceID            string
+	clientSecretName      string
+	clientSecretNamespace string
+	// allowedNamespaces is nil when unset and empty to allow all namespaces, configured with "*"
+	allowedNamespaces []string
+}
+
+func azureClusterIdentityFromEnv() (*azureClusterIdentity, error) {
+	id := &azureClusterIdentity{
+		identityType:          os.Getenv("AZURE_CLUSTER_IDENTITY_TYPE"),
+		clientID:              os.Getenv("AZURE_CLUSTER_IDENTITY_CLIENT_ID"),
+		tenantID:              os.Getenv("AZURE_CLUSTER_IDENTITY_TENANT_ID"),
+		resourceID:            os.Getenv("AZURE_CLUSTER_IDENTITY_RESOURCE_ID"),
+		clientSecretName:      os.Getenv("AZURE_CLUSTER_IDENTITY_SECRET_NAME"),
+		clientSecretNamespace: os.Getenv("AZURE_CLUSTER_IDENTITY_SECRET_NAMESPACE"),
+	}
+	if v := os.Getenv("AZURE_CLUSTER_IDENTITY_ALLOWED_NAMESPACES"); v != "" {
+		id.allowedNamespaces = []string{}
+		if v != "*" {
+			id.allowedNamespaces = splitList(v)
+		}
+	}
+	if err := validateOneOf("cluster identity type", id.identityType, azureIdentityTypes); err != nil {
+		return nil, err
+	}
+	for _, ns := range id.allowedNamespaces {
+		if errs := utilvalidation.IsDNS1123Label(ns); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid allowed namespace %q: %s", ns, strings.Join(errs, "; "))
+		}
+	}
+	return id, nil
+}
+
+// isSet reports whether anything beyond the client secret, which was supported before identity types, is configured.
+func (id *azureClusterIdentity) isSet() bool {
+	return id.identityType != "" || id.clientID != "" || id.tenantID != "" || id.resourceID != "" || id.allowedNamespaces != nil
+}
+
+func SetAzureClusterIdentity(ri parser.ResourceInfo, id *azureClusterIdentity) error {
+	obj := ri.Object.UnstructuredContent()
+	if id.clientSecretNamespace != "" && id.clientSecretName != "" {
+		clientSecret := map[string]any{
+			"name":      id.clientSecretName,
+			"namespace": id.clientSecretNamespace,
+		}
+		if err := unstructured.SetNestedMap(obj, clientSecret, "spec", "clientSecret"); err != nil {
+			return err
+		}
+	}
+	if !id.isSet() {
+		return nil
+	}
+
+	fields := map[string]string{
+		"type":       id.identityType,
+		"clientID":   id.clientID,
+		"tenantID":   id.tenantID,
+		"resourceID": id.resourceID,
+	}
+	for field, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := unstructured.SetNestedField(obj, value, "spec", field); err != nil {
+			return err
+		}
+	}
+	if id.allowedNamespaces != nil {
+		allowed := map[string]any{}
+		if len(id.allowedNamespaces) > 0 {
+			namespaces := make([]interface{}, 0, len(id.allowedNamespaces))
+			for _, ns := range id.allowedNamespaces {
+				namespaces = append(namespaces, ns)
+			}
+			allowed["list"] = namespaces
+		}
+		if err := unstructured.SetNestedMap(obj, allowed, "spec", "allowedNamespaces"); err != nil {
+			return err
+		}
+	}
+
+	return validateAzureClusterIdentity(ri)
+}
+
+// validateAzureClusterIdentity checks the fields required by the identity type of the resulting AzureClusterIdentity.
+func validateAzureClusterIdentity(ri parser.ResourceInfo) error {
+	spec, _, err := unstructured.NestedMap(ri.Object.UnstructuredContent(), "spec")
+	if err != nil {
+		return err
+	}
+	identityType, _ := spec["type"].(string)
+	clientID, _ := spec["clientID"].(string)
+	tenantID, _ := spec["tenantID"].(string)
+	resourceID, _ := spec["resourceID"].(string)
+	_, hasClientSecret := spec["clientSecret"]
+
+	if identityType == "" {
+		return errors.New("type in spec of AzureClusterIdentity is missing")
+	}
+	if err := validateOneOf("cluster identity type", identityType, azureIdentityTypes); err != nil {
+		return err
+	}
+	if !azureGUIDPattern.MatchString(clientID) {
+		return fmt.Errorf("AzureClusterIdentity of type %s requires a valid clientID, found %q", identityType, clientID)
+	}
+	if !azureGUIDPattern.MatchString(tenantID) {
+		return fmt.Errorf("AzureClusterIdentity of type %s requires a valid tenantID, found %q", identityType, tenantID)
+	}
+
+	switch identityType {
+	case azureIdentityServicePrincipal, azureIdentityManualServicePrincipal, azureIdentityServicePrincipalCertificate:
+		if !hasClientSecret {
+			return fmt.Errorf("AzureClusterIdentity of type %s requires clientSecret", identityType)
+		}
+		if resourceID != "" {
+			return fmt.Errorf("resourceID can't be set for AzureClusterIdentity of type %s", identityType)
+		}
+	case azureIdentityUserAssignedMSI:
+		if !azureUserAssignedIdentityIDPattern.MatchString(resourceID) {
+			return fmt.Errorf("AzureClusterIdentity of type %s requires a valid user assigned identity resourceID, found %q", identityType, resourceID)
+		}
+		if hasClientSecret {
+			return fmt.Errorf("clientSecret can't be set for AzureClusterIdentity of type %s", identityType)
+		}
+	case azureIdentityWorkloadIdentity:
+		if hasClientSecret {
+			return fmt.Errorf("clientSecret can't be set for AzureClusterIdentity of type %s", identityType)
+		}
+		if resourceID != "" {
+			return fmt.Errorf("resourceID can't be set for AzureClusterIdentity of type %s", identityType)
+		}
+	}
+	return nil
+}
+
+const (
+	azureMaxTagCount       = 50
+	azureMaxTagKeyLength   = 512
+	azureMaxTagValueLength = 256
+)
+
+var (
+	azureReservedTagPrefixes = []string{"microsoft", "azure", "windows"}
+	// addon names accepted in AKS_ADDON_PROFILES, mapped to the AKS addon profile names
+	azureAddonProfileNames = map[string]string{
+		"azure-keyvault-secrets-provider": "azureKeyvaultSecretsProvider",
+		"azurepolicy":                     "azurepolicy",
+		"omsagent":                        "omsagent",
+	}
+	azureLogAnalyticsWorkspaceIDPattern = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/resourceGroups/[^/]+/providers/Microsoft\.OperationalInsights/workspaces/[^/]+$`)
+)
+
+func parseAzureTags(s string) (map[string]string, error) {
+	tags, err := parseKeyValuePairs(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) > azureMaxTagCount {
+		return nil, fmt.Errorf("at most %d azure tags are allowed, found %d", azureMaxTagCount, len(tags))
+	}
+	for k, v := range tags {
+		if len(k) > azureMaxTagKeyLength {
+			return nil, fmt.Errorf("azure tag key %q is longer than %d characters", k, azureMaxTagKeyLength)
+		}
+		if len(v) > azureMaxTagValueLength {
+			return nil, fmt.Errorf("value of azure tag %q is longer than %d characters", k, azureMaxTagValueLength)
+		}
+		if strings.ContainsAny(k, `<>%&\?/`) {
+			return nil, fmt.Errorf("azure tag key %q can't contain any of <>%%&\\?/", k)
+		}
+		for _, prefix := range azureReservedTagPrefixes {
+			if strings.HasPrefix(strings.ToLower(k), prefix) {
+				return nil, fmt.Errorf("azure tag key %q uses the reserved %q prefix", k, prefix)
+			}
+		}
+	}
+	return tags, nil
+}
+
+type azureAddonProfile struct {
+	name   string
+	config map[string]string
+}
+
+func azureAddonProfilesFromEnv() ([]azureAddonProfile, error) {
+	workspaceID := os.Getenv("AKS_OMSAGENT_WORKSPACE_ID")
+	var addons []azureAddonProfile
+	for _, name := range splitList(os.Getenv("AKS_ADDON_PROFILES")) {
+		aksName, ok := azureAddonProfileNames[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported addon profile %q", name)
+		}
+		addon := azureAddonProfile{name: aksName}
+		if aksName == "omsagent" {
+			if !azureLogAnalyticsWorkspaceIDPattern.MatchString(workspaceID) {
+				return nil, fmt.Errorf("omsagent addon requires a valid log analytics workspace resource ID, found %q", workspaceID)
+			}
+			addon.config = map[string]string{
+				"logAnalyticsWorkspaceResourceID": workspaceID,
+			}
+		}
+		addons = append(addons, addon)
+	}
+	if workspaceID != "" && !slices.ContainsFunc(addons, func(a azureAddonProfile) bool { return a.name == "omsagent" }) {
+		return nil, errors.New("AKS_OMSAGENT_WORKSPACE_ID requires the omsagent addon profile")
+	}
+	return addons, nil
+}
+
+// SetAzureAddonProfiles enables the given addons, replacing existing profiles of the same name.
+func SetAzureAddonProfiles(ri parser.ResourceInfo, addons []azureAddonProfile) error {
+	profiles, _, err := unstructured.NestedSlice(ri.Object.UnstructuredContent(), "spec", "addonProfiles")
+	if err != nil {
+		return err
+	}
+	for _, addon := range addons {
+		profile := map[string]any{
+			"name":    addon.name,
+			"enabled": true,
+		}
+		if len(addon.config) > 0 {
+			config := make(map[string]any, len(addon.config))
+			for k, v := range addon.config {
+				config[k] = v
+			}
+			profile["config"] = config
+		}
+		profiles = slices.DeleteFunc(profiles, func(p interface{}) bool {
+			m, ok := p.(map[string]any)
+			return ok && m["name"] == addon.name
+		})
+		profiles = append(profiles, profile)
+	}
+	return unstructured.SetNestedSlice(ri.Object.UnstructuredContent(), profiles, "spec", "addonProfiles")
+}
+
+// pairAzureMachinePools follows the infrastructureRef of every MachinePool to its AzureManagedMachinePool
+// and returns the mode of the referenced pool, keyed by MachinePool name.
+func pairAzureMachinePools(in []byte) (map[string]string, error) {
+	poolModes := make(map[string]string)
+	var machinePools []parser.ResourceInfo
+	err := parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
+		if ri.Object.GetAPIVersion() == infraApiVersion &&
+			ri.Object.GetKind() == azureManagedMachinePoolKind {
+			if _, ok := poolModes[ri.Object.GetName()]; ok {
+				return fmt.Errorf("duplicate AzureManagedMachinePool %s", ri.Object.GetName())
+			}
+			mode, ok, err := unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "mode")
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errors.New("mode in spec of AzureManagedMachinePool is missing")
+			}
+			poolModes[ri.Object.GetName()] = mode
+		} else if ri.Object.GetAPIVersion() == clusterApiVersion &&
+			ri.Object.GetKind() == machinePoolKind {
+			machinePools = append(machinePools, ri)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	modes := make(map[string]string, len(machinePools))
+	referencedBy := make(map[string]string, len(machinePools))
+	for _, ri := range machinePools {
+		name := ri.Object.GetName()
+		if name == "" {
+			return nil, errors.New("name in MachinePool is missing")
+		}
+		if _, ok := modes[name]; ok {
+			return nil, fmt.Errorf("duplicate MachinePool %s", name)
+		}
+		ref, _, err := unstructured.NestedStringMap(ri.Object.UnstructuredContent(), "spec", "template", "spec", "infrastructureRef")
+		if err != nil {
+			return nil, err
+		}
+		if ref["kind"] != azureManagedMachinePoolKind {
+			return nil, fmt.Errorf("infrastructureRef of MachinePool %s does not refer to an AzureManagedMachinePool", name)
+		}
+		mode, ok := poolModes[ref["name"]]
+		if !ok {
+			return nil, fmt.Errorf("AzureManagedMachinePool %q referenced by MachinePool %s not found", ref["name"], name)
+		}
+		if other, ok := referencedBy[ref["name"]]; ok {
+			return nil, fmt.Errorf("AzureManagedMachinePool %s is referenced by both MachinePool %s and %s", ref["name"], other, name)
+		}
+		referencedBy[ref["name"]] = name
+		modes[name] = mode
+	}
+	for pool := range poolModes {
+		if _, ok := referencedBy[pool]; !ok {
+			return nil, fmt.Errorf("AzureManagedMachinePool %s is not referenced by any MachinePool", pool)
+		}
+	}
+	return modes, nil
+}
+
+// azureManagedMachinePoolOSType returns the os type of the AzureManagedMachinePool with the given mode,
+// overridden by osType when it is set.
+func azureManagedMachinePoolOSType(in []byte, mode, osType string) (string, error) {
+	if osType != "" {
+		return osType, nil
+	}
+	err := parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
+		if ri.Object.GetAPIVersion() != infraApiVersion ||
+			ri.Object.GetKind() != azureManagedMachinePoolKind || osType != "" {
+			return nil
+		}
+		poolMode, _, err := unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "mode")
+		if err != nil || poolMode != mode {
+			return err
+		}
+		osType, _, err = unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "osType")
+		return err
+	})
+	return osType, err
+}
+
 func NewCmdCAPZ() *cobra.Command {
 	var (
 		systemMPMinSize int64
@@ -48,23 +904,125 @@ func NewCmdCAPZ() *cobra.Command {
 				return err
 			}
 
+			machinePoolModes, err := pairAzureMachinePools(in)
+			if err != nil {
+				return err
+			}
+			networkProfile, err := azureNetworkProfileFromEnv()
+			if err != nil {
+				return err
+			}
+			apiServerAccessProfile, err := azureAPIServerAccessProfileFromEnv()
+			if err != nil {
+				return err
+			}
+			systemPoolOptions, err := azureMachinePoolOptionsFromEnv("AKS_SYSTEM_POOL")
+			if err != nil {
+				return err
+			}
+			systemPoolOSType, err := azureManagedMachinePoolOSType(in, "System", systemPoolOptions.osType)
+			if err != nil {
+				return err
+			}
+			if systemPoolOSType == azureOSTypeWindows {
+				return errors.New("system AzureManagedMachinePool must use the Linux os type")
+			}
+			systemPoolName := systemPoolOptions.name
+			if systemPoolName == "" {
+				systemPoolName = defaultSystemPoolName
+			}
+			if len(systemPoolOptions.taints) == 0 {
+				systemPoolOptions.taints = defaultSystemPoolTaints
+			}
+			userPoolOptions, err := azureMachinePoolOptionsFromEnv("AKS_USER_POOL")
+			if err != nil {
+				return err
+			}
+			userPoolOSType, err := azureManagedMachinePoolOSType(in, "User", userPoolOptions.osType)
+			if err != nil {
+				return err
+			}
+			userPoolName := userPoolOptions.name
+			if userPoolName == "" {
+				userPoolName = deafultMachinePoolName
+				if userPoolOSType == azureOSTypeWindows {
+					userPoolName = defaultWindowsPoolName
+				}
+			}
+			if userPoolOSType == azureOSTypeWindows && !azureWindowsPoolNamePattern.MatchString(userPoolName) {
+				return fmt.Errorf("invalid windows pool name %q, must be at most 6 lowercase alphanumeric characters starting with a letter", userPoolName)
+			}
+			if systemPoolName == userPoolName {
+				return fmt.Errorf("system and user pools can't both be named %s", systemPoolName)
+			}
+			clusterIdentity, err := azureClusterIdentityFromEnv()
+			if err != nil {
+				return err
+			}
+			autoscalerProfile, err := azureAutoscalerProfileFromEnv()
+			if err != nil {
+				return err
+			}
+			additionalTags, err := parseAzureTags(os.Getenv("AZURE_ADDITIONAL_TAGS"))
+			if err != nil {
+				return err
+			}
+			addonProfiles, err := azureAddonProfilesFromEnv()
+			if err != nil {
+				return err
+			}
+			upgradeChannel := os.Getenv("AKS_AUTO_UPGRADE_CHANNEL")
+			if err := validateOneOf("auto upgrade channel", upgradeChannel, azureUpgradeChannels); err != nil {
+				return err
+			}
+
 			var out bytes.Buffer
 			var foundCP bool
 			var foundUserManagedMP bool
 			var foundSysMP bool
 			var foundSysManagedMP bool
 			var foundUserMP bool
+			var foundCluster bool
+			var foundWindowsMP bool
+			var networkPlugin string
 			err = parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
 				if ri.Object.GetAPIVersion() == infraApiVersion &&
-					ri.Object.GetKind() == "AzureManagedControlPlane" {
+					ri.Object.GetKind() == azureManagedControlPlaneKind {
 					foundCP = true
 
 					if err := SetAzureNetworkConfiguration(ri); err != nil {
 						return err
 					}
+					if err := SetAzureNetworkProfile(ri, networkProfile); err != nil {
+						return err
+					}
+					if networkPlugin, _, err = unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "networkPlugin"); err != nil {
+						return err
+					}
+					if err := mergeNestedStringMap(ri.Object.UnstructuredContent(), additionalTags, "spec", "additionalTags"); err != nil {
+						return err
+					}
+					if len(addonProfiles) > 0 {
+						if err := SetAzureAddonProfiles(ri, addonProfiles); err != nil {
+							return err
+						}
+					}
+					if err := SetAzureAutoscalerProfile(ri, autoscalerProfile); err != nil {
+						return err
+					}
+					if upgradeChannel != "" {
+						if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), upgradeChannel, "spec", "autoUpgradeProfile", "upgradeChannel"); err != nil {
+							return err
+						}
+					}
+					if apiServerAccessProfile.isSet() {
+						if err := SetAzureAPIServerAccessProfile(ri, apiServerAccessProfile); err != nil {
+							return err
+						}
+					}
 
 				} else if ri.Object.GetAPIVersion() == infraApiVersion &&
-					ri.Object.GetKind() == "AzureManagedMachinePool" {
+					ri.Object.GetKind() == azureManagedMachinePoolKind {
 
 					mode, ok, err := unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "mode")
 					if err != nil {
@@ -77,68 +1035,85 @@ func NewCmdCAPZ() *cobra.Command {
 					var minSize int64
 					var maxSize int64
 					var newName string
+					var opts *azureMachinePoolOptions
 					if mode == "System" {
 						foundSysManagedMP = true
 						minSize = systemMPMinSize
 						maxSize = systemMPMaxSize
-						newName = "sys0"
+						newName = systemPoolName
+						opts = systemPoolOptions
 
 					} else if mode == "User" {
 						foundUserManagedMP = true
 						minSize = userMPMinSize
 						maxSize = userMPMaxSize
-						newName = deafultMachinePoolName
+						newName = userPoolName
+						opts = userPoolOptions
 					}
 
-					if err := SetAzureManagedMPConfiguration(ri, newName, mode, minSize, maxSize); err != nil {
+					if err := SetAzureManagedMPConfiguration(ri, newName, minSize, maxSize); err != nil {
+						return err
+					}
+					if opts != nil {
+						if err := SetAzureManagedMPOptions(ri, opts); err != nil {
+							return err
+						}
+					}
+					if err := mergeNestedStringMap(ri.Object.UnstructuredContent(), additionalTags, "spec", "additionalTags"); err != nil {
 						return err
 					}
 
-				} else if ri.Object.GetAPIVersion() == clusterApiVersion &&
-					ri.Object.GetKind() == "MachinePool" {
-
-					name, ok, err := unstructured.NestedString(ri.Object.UnstructuredContent(), "metadata", "name")
+					osType, _, err := unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "osType")
 					if err != nil {
 						return err
 					}
-					if !ok {
-						return errors.New("name in MachinePool is missing")
+					if osType == azureOSTypeWindows {
+						foundWindowsMP = true
+						if err := SetAzureWindowsMPConfiguration(ri); err != nil {
+							return err
+						}
 					}
-					mode := strings.HasSuffix(name, "pool0")
+
+				} else if ri.Object.GetAPIVersion() == clusterApiVersion &&
+					ri.Object.GetKind() == machinePoolKind {
 
 					var newName string
 					var minSize int64
 					var maxSize int64
-					if mode {
+					switch machinePoolModes[ri.Object.GetName()] {
+					case "System":
 						foundSysMP = true
 						minSize = systemMPMinSize
 						maxSize = systemMPMaxSize
-						newName = "sys0"
-					} else {
+						newName = systemPoolName
+					case "User":
 						foundUserMP = true
 						minSize = userMPMinSize
 						maxSize = userMPMaxSize
-						newName = "default"
+						newName = userPoolName
+					default:
+						return fmt.Errorf("unknown mode %q of AzureManagedMachinePool for MachinePool %s", machinePoolModes[ri.Object.GetName()], ri.Object.GetName())
 					}
 					if err := SetMPConfiguration(ri, newName, minSize, maxSize); err != nil {
 						return err
 					}
 
-				} else if ri.Object.GetAPIVersion() == infraApiVersion &&
-					ri.Object.GetKind() == "AzureClusterIdentity" {
-
-					clientSecretName := os.Getenv("AZURE_CLUSTER_IDENTITY_SECRET_NAME")
-					clientSecretNamespace := os.Getenv("AZURE_CLUSTER_IDENTITY_SECRET_NAMESPACE")
+				} else if ri.Object.GetAPIVersion() == clusterApiVersion &&
+					ri.Object.GetKind() == clusterKind {
+					foundCluster = true
 
-					if clientSecretNamespace != "" && clientSecretName != "" {
-						clientSecret := map[string]any{
-							"name":      clientSecretName,
-							"namespace": clientSecretNamespace,
-						}
-						if err := unstructured.SetNestedMap(ri.Object.UnstructuredContent(), clientSecret, "spec", "clientSecret"); err != nil {
+					if networkProfile.serviceCIDR != "" {
+						if err := unstructured.SetNestedStringSlice(ri.Object.UnstructuredContent(), []string{networkProfile.serviceCIDR}, "spec", "clusterNetwork", "services", "cidrBlocks"); err != nil {
 							return err
 						}
 					}
+
+				} else if ri.Object.GetAPIVersion() == infraApiVersion &&
+					ri.Object.GetKind() == azureClusterIdentityKind {
+
+					if err := SetAzureClusterIdentity(ri, clusterIdentity); err != nil {
+						return err
+					}
 				}
 
 				data, err := yaml.Marshal(ri.Object)
@@ -170,6 +1145,12 @@ func NewCmdCAPZ() *cobra.Command {
 			if !foundUserMP {
 				return errors.New("user MachinePool not found")
 			}
+			if foundWindowsMP && networkPlugin != "" && networkPlugin != "azure" {
+				return fmt.Errorf("windows AzureManagedMachinePool requires the azure network plugin, found %s", networkPlugin)
+			}
+			if networkProfile.serviceCIDR != "" && !foundCluster {
+				return errors.New("failed to get Cluster for service CIDR configuration")
+			}
 
 			_, err = os.Stdout.Write(out.Bytes())
 			return err
@@ -184,19 +1165,7 @@ func NewCmdCAPZ() *cobra.Command {
 	return cmd
 }
 
-func SetAzureManagedMPConfiguration(ri parser.ResourceInfo, name string, mode string, minSize int64, maxSize int64) error {
-	if mode == "System" {
-		taint := map[string]any{
-			"key":    "CriticalAddonsOnly",
-			"value":  "true",
-			"effect": "NoSchedule",
-		}
-		taints := []interface{}{taint}
-		if err := unstructured.SetNestedSlice(ri.Object.UnstructuredContent(), taints, "spec", "taints"); err != nil {
-			return err
-		}
-	}
-
+func SetAzureManagedMPConfiguration(ri parser.ResourceInfo, name string, minSize int64, maxSize int64) error {
 	scalingCfg := map[string]any{
 		"minSize": minSize,
 		"maxSize": maxSize,
@@ -224,6 +1193,50 @@ func SetAzureNetworkConfiguration(ri parser.ResourceInfo) error {
 	}
 	vNetCidr := os.Getenv("VNET_CIDR")
 	subnetCidr := os.Getenv("SUBNET_CIDR")
+	vNetName := os.Getenv("AZURE_VNET_NAME")
+	vNetResourceGroup := os.Getenv("AZURE_VNET_RESOURCE_GROUP")
+	subnetName := os.Getenv("AZURE_SUBNET_NAME")
+
+	if vNetCidr != "" && subnetCidr != "" {
+		if err := validateSubnetCIDR(vNetCidr, subnetCidr); err != nil {
+			return err
+		}
+	}
+
+	// reuse an existing vnet, possibly in another resource group, where the cidrs are optional
+	if vNetName != "" || vNetResourceGroup != "" || subnetName != "" {
+		if vNetName == "" || subnetName == "" {
+			return errors.New("both AZURE_VNET_NAME and AZURE_SUBNET_NAME are required to use an existing vnet")
+		}
+		if !azureVNetNamePattern.MatchString(vNetName) {
+			return fmt.Errorf("invalid vnet name %q", vNetName)
+		}
+		if !azureSubnetNamePattern.MatchString(subnetName) {
+			return fmt.Errorf("invalid subnet name %q", subnetName)
+		}
+		if vNetResourceGroup != "" && !azureResourceGroupPattern.MatchString(vNetResourceGroup) {
+			return fmt.Errorf("invalid vnet resource group %q", vNetResourceGroup)
+		}
+
+		subnet := map[string]any{
+			"name": subnetName,
+		}
+		if subnetCidr != "" {
+			subnet["cidrBlock"] = subnetCidr
+		}
+		netcfg := map[string]any{
+			"name":   vNetName,
+			"subnet": subnet,
+		}
+		if vNetCidr != "" {
+			netcfg["cidrBlock"] = vNetCidr
+		}
+		if vNetResourceGroup != "" {
+			netcfg["resourceGroup"] = vNetResourceGroup
+		}
+		return unstructured.SetNestedMap(ri.Object.UnstructuredContent(), netcfg, "spec", "virtualNetwork")
+	}
+
 	if vNetCidr == "" || subnetCidr == "" {
 		return nil
 	}
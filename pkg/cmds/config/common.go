@@ -17,9 +17,14 @@ limitations under the License.
 package config
 
 import (
+	"fmt"
+	"net"
+	"slices"
 	"strconv"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilvalidation "k8s.io/apimachinery/pkg/util/validation"
 	"kmodules.xyz/client-go/tools/parser"
 )
 
@@ -42,3 +47,170 @@ func SetMPConfiguration(ri parser.ResourceInfo, name string, minSize int64, maxS
 
 	return nil
 }
+
+// parseKeyValuePairs parses a comma separated list of key=value pairs, e.g. "env=prod,owner=platform".
+func parseKeyValuePairs(s string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, item := range splitList(s) {
+		key, value, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid key value pair %q, expected format key=value", item)
+		}
+		pairs[key] = strings.TrimSpace(value)
+	}
+	return pairs, nil
+}
+
+// splitList splits a comma separated list, dropping empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// mergeNestedStringMap merges values into the string map found at fields, overriding existing keys.
+func mergeNestedStringMap(obj map[string]any, values map[string]string, fields ...string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	merged, _, err := unstructured.NestedStringMap(obj, fields...)
+	if err != nil {
+		return err
+	}
+	if merged == nil {
+		merged = make(map[string]string, len(values))
+	}
+	for k, v := range values {
+		merged[k] = v
+	}
+	return unstructured.SetNestedStringMap(obj, merged, fields...)
+}
+
+// validateOneOf returns an error if value is set and is not one of allowed.
+func validateOneOf(name, value string, allowed []string) error {
+	if value != "" && !slices.Contains(allowed, value) {
+		return fmt.Errorf("invalid %s %q, must be one of %s", name, value, strings.Join(allowed, ", "))
+	}
+	return nil
+}
+
+var taintEffects = []string{"NoSchedule", "PreferNoSchedule", "NoExecute"}
+
+type nodeTaint struct {
+	key, value, effect string
+}
+
+// parseTaints parses a comma separated list of taints in kubectl format, e.g. "dedicated=gpu:NoSchedule,spot:NoExecute".
+func parseTaints(s string) ([]nodeTaint, error) {
+	var taints []nodeTaint
+	for _, item := range splitList(s) {
+		kv, effect, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid taint %q, expected format key[=value]:effect", item)
+		}
+		key, value, _ := strings.Cut(kv, "=")
+		if errs := utilvalidation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid taint key %q: %s", key, strings.Join(errs, "; "))
+		}
+		if errs := utilvalidation.IsValidLabelValue(value); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid taint value %q: %s", value, strings.Join(errs, "; "))
+		}
+		if err := validateOneOf("taint effect", effect, taintEffects); err != nil {
+			return nil, err
+		}
+		taints = append(taints, nodeTaint{key: key, value: value, effect: effect})
+	}
+	return taints, nil
+}
+
+// parseNodeLabels parses a comma separated list of key=value node labels and validates them as kubernetes labels.
+func parseNodeLabels(s string) (map[string]string, error) {
+	labels, err := parseKeyValuePairs(s)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range labels {
+		if errs := utilvalidation.IsQualifiedName(k); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid label key %q: %s", k, strings.Join(errs, "; "))
+		}
+		if errs := utilvalidation.IsValidLabelValue(v); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid value %q for label %s: %s", v, k, strings.Join(errs, "; "))
+		}
+	}
+	return labels, nil
+}
+
+// validateSubnetCIDR checks that subnetCidr is a valid CIDR that lies within networkCidr.
+func validateSubnetCIDR(networkCidr, subnetCidr string) error {
+	_, network, err := net.ParseCIDR(networkCidr)
+	if err != nil {
+		return fmt.Errorf("invalid network CIDR %q: %w", networkCidr, err)
+	}
+	_, subnet, err := net.ParseCIDR(subnetCidr)
+	if err != nil {
+		return fmt.Errorf("invalid subnet CIDR %q: %w", subnetCidr, err)
+	}
+	networkOnes, _ := network.Mask.Size()
+	subnetOnes, _ := subnet.Mask.Size()
+	if !network.Contains(subnet.IP) || subnetOnes < networkOnes {
+		return fmt.Errorf("subnet CIDR %s is not within network CIDR %s", subnetCidr, networkCidr)
+	}
+	return nil
+}
+
+// mergeNestedTaints adds taints to the taint list found at fields, replacing existing taints with the same key and effect.
+func mergeNestedTaints(obj map[string]any, taints []nodeTaint, fields ...string) error {
+	if len(taints) == 0 {
+		return nil
+	}
+	merged, _, err := unstructured.NestedSlice(obj, fields...)
+	if err != nil {
+		return err
+	}
+	for _, t := range taints {
+		merged = slices.DeleteFunc(merged, func(existing interface{}) bool {
+			m, ok := existing.(map[string]any)
+			return ok && m["key"] == t.key && m["effect"] == t.effect
+		})
+		taint := map[string]any{
+			"key":    t.key,
+			"effect": t.effect,
+		}
+		if t.value != "" {
+			taint["value"] = t.value
+		}
+		merged = append(merged, taint)
+	}
+	return unstructured.SetNestedSlice(obj, merged, fields...)
+}
+
+// validateNonOverlappingCIDRs checks that the given named CIDRs are valid and pairwise disjoint. Empty CIDRs are skipped.
+func validateNonOverlappingCIDRs(cidrs map[string]string) error {
+	names := make([]string, 0, len(cidrs))
+	nets := make(map[string]*net.IPNet, len(cidrs))
+	for name, cidr := range cidrs {
+		if cidr == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", name, cidr, err)
+		}
+		names = append(names, name)
+		nets[name] = ipNet
+	}
+	slices.Sort(names)
+	for i, a := range names {
+		for _, b := range names[i+1:] {
+			if nets[a].Contains(nets[b].IP) || nets[b].Contains(nets[a].IP) {
+				return fmt.Errorf("%s %s overlaps with %s %s", a, cidrs[a], b, cidrs[b])
+			}
+		}
+	}
+	return nil
+}
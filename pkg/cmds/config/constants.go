@@ -19,5 +19,6 @@ package config
 const (
 	infraApiVersion        = "infrastructure.cluster.x-k8s.io/v1beta1"
 	clusterApiVersion      = "cluster.x-k8s.io/v1beta1"
+	controlPlaneApiVersion = "controlplane.cluster.x-k8s.io/v1beta1"
 	deafultMachinePoolName = "default"
 )
@@ -0,0 +1,76 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"sigs.k8s.io/yaml"
+)
+
+const gkeReleaseChannelNone = "none"
+
+var gkeReleaseChannels = []string{"rapid", "regular", "stable", gkeReleaseChannelNone}
+
+//go:embed gke-release-channels.yaml
+var gkeReleaseChannelVersions []byte
+
+// loadGKEReleaseChannelVersions returns the kubernetes minor versions available per release channel,
+// read from GKE_RELEASE_CHANNEL_VERSIONS_FILE if set or the embedded table otherwise.
+func loadGKEReleaseChannelVersions() (map[string][]string, error) {
+	data := gkeReleaseChannelVersions
+	if filename := os.Getenv("GKE_RELEASE_CHANNEL_VERSIONS_FILE"); filename != "" {
+		var err error
+		if data, err = os.ReadFile(filename); err != nil {
+			return nil, err
+		}
+	}
+	var versions map[string][]string
+	if err := yaml.UnmarshalStrict(data, &versions); err != nil {
+		return nil, fmt.Errorf("failed to parse GKE release channel versions: %w", err)
+	}
+	return versions, nil
+}
+
+// validateGKEReleaseChannelVersion checks that the minor version of the control plane is offered in the release channel.
+func validateGKEReleaseChannelVersion(channel, version string) error {
+	if channel == "" || channel == gkeReleaseChannelNone || version == "" || version == "latest" {
+		return nil
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return fmt.Errorf("invalid control plane version %q: %w", version, err)
+	}
+	channelVersions, err := loadGKEReleaseChannelVersions()
+	if err != nil {
+		return err
+	}
+	minors, ok := channelVersions[channel]
+	if !ok {
+		return fmt.Errorf("no versions known for GKE release channel %s", channel)
+	}
+	minor := fmt.Sprintf("%d.%d", v.Major(), v.Minor())
+	if !slices.Contains(minors, minor) {
+		return fmt.Errorf("control plane version %s is not available in the %s release channel, available minor versions are %s", version, channel, strings.Join(minors, ", "))
+	}
+	return nil
+}